@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"os2cb/export"
+)
+
+// Unterstützte Dateiformate mit Proben-IDs
+const (
+	VcfFormat = "vcf"
+	SegFormat = "seg"
+	MafFormat = "maf"
+)
+
+var vcfMetaSampleRegExp = regexp.MustCompile("^(##SAMPLE=<(?:.*,)?ID=)([^,>]+)(.*)$")
+var vcfMetaSampleLineRegExp = regexp.MustCompile("^(##(?:tumor|normal)_sample=)(.+)$")
+
+// Anonymisiert Proben-IDs analog zum Export der Probendaten
+func sampleIDAnonymizer(pseudonymizer export.Pseudonymizer) func(id string) string {
+	return func(id string) string {
+		return pseudonymizer.Pseudonymize(export.SanitizeSampleId(strings.TrimSpace(id)))
+	}
+}
+
+// Ermittelt das Dateiformat anhand der Dateiendung. Die Endung '.gz' wird dabei ignoriert.
+func detectFileFormat(filename string) (string, error) {
+	name := strings.TrimSuffix(strings.ToLower(filename), ".gz")
+	switch filepath.Ext(name) {
+	case ".vcf":
+		return VcfFormat, nil
+	case ".seg":
+		return SegFormat, nil
+	case ".maf":
+		return MafFormat, nil
+	}
+	return "", fmt.Errorf("anonymize: Dateiformat von '%s' kann nicht ermittelt werden", filename)
+}
+
+// Öffnet eine Datei zum Lesen. Gzip-komprimierte Dateien werden anhand der Magic Bytes erkannt und entpackt.
+func openInputFile(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.New("anonymize: Datei kann nicht geöffnet werden")
+	}
+
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			_ = file.Close()
+			return nil, errors.New("anonymize: Gzip-Datei kann nicht gelesen werden")
+		}
+		return &readCloser{Reader: gzipReader, closers: []io.Closer{gzipReader, file}}, nil
+	}
+
+	return &readCloser{Reader: reader, closers: []io.Closer{file}}, nil
+}
+
+// Erstellt eine Datei zum Schreiben. Endet der Dateiname auf '.gz', wird gzip-komprimiert.
+func createOutputFile(filename string) (io.WriteCloser, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, errors.New("anonymize: Datei kann nicht geöffnet werden")
+	}
+
+	if strings.HasSuffix(strings.ToLower(filename), ".gz") {
+		gzipWriter := gzip.NewWriter(file)
+		return &writeCloser{Writer: gzipWriter, closers: []io.Closer{gzipWriter, file}}, nil
+	}
+
+	return file, nil
+}
+
+// Prüft, ob beide Dateinamen auf dieselbe existierende Datei verweisen
+func sameFile(filename string, otherFilename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	otherInfo, err := os.Stat(otherFilename)
+	return err == nil && os.SameFile(info, otherInfo)
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var errs []error
+	for _, closer := range r.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *writeCloser) Close() error {
+	var errs []error
+	for _, closer := range w.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Liest zeilenweise aus in und schreibt die durch rewrite geänderten Zeilen nach out.
+// Zeilenenden bleiben dabei unverändert.
+func rewriteLines(in io.Reader, out io.Writer, rewrite func(line string) (string, error)) error {
+	reader := bufio.NewReader(in)
+	writer := bufio.NewWriter(out)
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return errors.New("anonymize: Daten können nicht gelesen werden")
+		}
+
+		if len(line) > 0 {
+			content := strings.TrimRight(line, "\r\n")
+			ending := line[len(content):]
+
+			rewritten, err := rewrite(content)
+			if err != nil {
+				return err
+			}
+			if _, err := writer.WriteString(rewritten + ending); err != nil {
+				return errors.New("anonymize: Daten können nicht geschrieben werden")
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return errors.New("anonymize: Daten können nicht geschrieben werden")
+	}
+	return nil
+}
+
+// Anonymisiert Proben-IDs einer VCF-Datei
+func AnonymizeVcf(in io.Reader, out io.Writer, pseudonymizer export.Pseudonymizer) error {
+	return rewriteVcfSampleIds(in, out, sampleIDAnonymizer(pseudonymizer))
+}
+
+// Ersetzt Proben-IDs einer VCF-Datei. Ersetzt werden die Probenspalten der Kopfzeile '#CHROM'
+// und Proben-IDs in den Meta-Zeilen '##SAMPLE', '##tumor_sample' und '##normal_sample'.
+func rewriteVcfSampleIds(in io.Reader, out io.Writer, rewrite func(id string) string) error {
+	return rewriteLines(in, out, func(line string) (string, error) {
+		if strings.HasPrefix(line, "#CHROM") {
+			columns := strings.Split(line, "\t")
+			// Probenspalten folgen nach der Spalte FORMAT (Index 8)
+			for idx := 9; idx < len(columns); idx++ {
+				columns[idx] = rewrite(columns[idx])
+			}
+			return strings.Join(columns, "\t"), nil
+		}
+
+		if matches := vcfMetaSampleRegExp.FindStringSubmatch(line); matches != nil {
+			return matches[1] + rewrite(matches[2]) + matches[3], nil
+		}
+
+		if matches := vcfMetaSampleLineRegExp.FindStringSubmatch(line); matches != nil {
+			return matches[1] + rewrite(matches[2]), nil
+		}
+
+		return line, nil
+	})
+}
+
+// Anonymisiert Proben-IDs einer SEG-Datei (Spalte 'ID', ansonsten erste Spalte)
+func AnonymizeSeg(in io.Reader, out io.Writer, pseudonymizer export.Pseudonymizer) error {
+	return rewriteTsvColumns(in, out, func(header []string) []int {
+		for idx, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), "ID") {
+				return []int{idx}
+			}
+		}
+		return []int{0}
+	}, sampleIDAnonymizer(pseudonymizer))
+}
+
+// Anonymisiert Proben-IDs einer MAF-Datei (Spalten 'Tumor_Sample_Barcode' und 'Matched_Norm_Sample_Barcode')
+func AnonymizeMaf(in io.Reader, out io.Writer, pseudonymizer export.Pseudonymizer) error {
+	return rewriteTsvColumns(in, out, mafColumns("Tumor_Sample_Barcode", "Matched_Norm_Sample_Barcode"), sampleIDAnonymizer(pseudonymizer))
+}
+
+// Ermittelt die Indizes der angegebenen Spalten einer MAF-Datei
+func mafColumns(names ...string) func(header []string) []int {
+	return func(header []string) []int {
+		var result []int
+		for idx, column := range header {
+			if slices.Contains(names, strings.TrimSpace(column)) {
+				result = append(result, idx)
+			}
+		}
+		return result
+	}
+}
+
+// Ersetzt die Werte der Spalten einer TSV-Datei, deren Indizes anhand der Kopfzeile durch columnsFunc ermittelt werden.
+// Kommentarzeilen ('#') vor der Kopfzeile bleiben unverändert.
+func rewriteTsvColumns(in io.Reader, out io.Writer, columnsFunc func(header []string) []int, rewrite func(id string) string) error {
+	var columnIndices []int
+	headerFound := false
+
+	return rewriteLines(in, out, func(line string) (string, error) {
+		if !headerFound {
+			if strings.HasPrefix(line, "#") || len(strings.TrimSpace(line)) == 0 {
+				return line, nil
+			}
+			headerFound = true
+			columnIndices = columnsFunc(strings.Split(line, "\t"))
+			if len(columnIndices) == 0 {
+				return "", errors.New("anonymize: Keine Spalte mit Proben-IDs gefunden")
+			}
+			return line, nil
+		}
+
+		if len(line) == 0 {
+			return line, nil
+		}
+
+		columns := strings.Split(line, "\t")
+		for _, idx := range columnIndices {
+			if idx < len(columns) {
+				columns[idx] = rewrite(columns[idx])
+			}
+		}
+		return strings.Join(columns, "\t"), nil
+	})
+}
+
+// Anonymisiert Proben-IDs in der angegebenen Eingabedatei und schreibt das Ergebnis in die Ausgabedatei
+func AnonymizeFile(inputFilename string, outputFilename string, format string, pseudonymizer export.Pseudonymizer) error {
+	if format == "" || format == "auto" {
+		if f, err := detectFileFormat(inputFilename); err == nil {
+			format = f
+		} else {
+			return err
+		}
+	}
+
+	var anonymizeFunc func(in io.Reader, out io.Writer, pseudonymizer export.Pseudonymizer) error
+	switch format {
+	case VcfFormat:
+		anonymizeFunc = AnonymizeVcf
+	case SegFormat:
+		anonymizeFunc = AnonymizeSeg
+	case MafFormat:
+		anonymizeFunc = AnonymizeMaf
+	default:
+		return fmt.Errorf("anonymize: Dateiformat '%s' wird nicht unterstützt", format)
+	}
+
+	input, err := openInputFile(inputFilename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+
+	// Die Eingabedatei würde sonst vor dem Lesen geleert
+	if sameFile(inputFilename, outputFilename) {
+		return errors.New("anonymize: Eingabe- und Ausgabedatei dürfen nicht identisch sein")
+	}
+
+	output, err := createOutputFile(outputFilename)
+	if err != nil {
+		return err
+	}
+
+	if err := anonymizeFunc(input, output, pseudonymizer); err != nil {
+		_ = output.Close()
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		return errors.New("anonymize: Datei kann nicht geschrieben werden")
+	}
+
+	return nil
+}
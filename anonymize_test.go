@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"os2cb/export"
+)
+
+func TestShouldAnonymizeVcfSampleColumns(t *testing.T) {
+	pseudonymizer := export.HashPseudonymizer{Prefix: "WUE"}
+
+	input := "##fileformat=VCFv4.2\n" +
+		"##tumor_sample=H/2024/1234\n" +
+		"##SAMPLE=<ID=H/2024/1234,Description=\"Tumor\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tH/2024/1234\tN/2024/5678\n" +
+		"chr1\t100\t.\tA\tG\t.\tPASS\t.\tGT\t0/1\t0/0\n"
+
+	var out bytes.Buffer
+	if err := AnonymizeVcf(strings.NewReader(input), &out, pseudonymizer); err != nil {
+		t.Fatal(err)
+	}
+
+	tumor := pseudonymizer.Pseudonymize("H1234-24")
+	normal := pseudonymizer.Pseudonymize("N5678-24")
+	expected := "##fileformat=VCFv4.2\n" +
+		"##tumor_sample=" + tumor + "\n" +
+		"##SAMPLE=<ID=" + tumor + ",Description=\"Tumor\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t" + tumor + "\t" + normal + "\n" +
+		"chr1\t100\t.\tA\tG\t.\tPASS\t.\tGT\t0/1\t0/0\n"
+
+	if out.String() != expected {
+		t.Logf("wrong value: Expected %s, got %s", expected, out.String())
+		t.Fail()
+	}
+}
+
+func TestShouldAnonymizeSegIdColumn(t *testing.T) {
+	pseudonymizer := export.HashPseudonymizer{Prefix: "WUE"}
+
+	input := "chrom\tID\tloc.start\tloc.end\tnum.mark\tseg.mean\r\n" +
+		"1\tH/2024/1234\t100\t200\t10\t0.5\r\n"
+
+	var out bytes.Buffer
+	if err := AnonymizeSeg(strings.NewReader(input), &out, pseudonymizer); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "chrom\tID\tloc.start\tloc.end\tnum.mark\tseg.mean\r\n" +
+		"1\t" + pseudonymizer.Pseudonymize("H1234-24") + "\t100\t200\t10\t0.5\r\n"
+
+	if out.String() != expected {
+		t.Logf("wrong value: Expected %s, got %s", expected, out.String())
+		t.Fail()
+	}
+}
+
+func TestShouldDetectFileFormat(t *testing.T) {
+	testsArgs := map[string]string{
+		"sample.vcf":    VcfFormat,
+		"sample.vcf.gz": VcfFormat,
+		"cnv.SEG":       SegFormat,
+		"data.maf.gz":   MafFormat,
+	}
+
+	for key, value := range testsArgs {
+		actual, err := detectFileFormat(key)
+		if err != nil || actual != value {
+			t.Logf("wrong format: Expected %s, got %s", value, actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldParseAnonymizeFileWithoutDatabase(t *testing.T) {
+	parse := jobStepParser(kongOptions())
+
+	actual, kctx, err := parse([]string{"anonymize-file", "--input", "in.vcf", "--output", "out.vcf"})
+	if err != nil || kctx.Command() != "anonymize-file" || actual.AnonymizeFile.Input != "in.vcf" {
+		t.Logf("cannot parse anonymize-file without user and patients: %v", err)
+		t.Fail()
+	}
+}
+
+func TestShouldNotAnonymizeFileInPlace(t *testing.T) {
+	input := "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tH/2024/1234\n"
+	filename := filepath.Join(t.TempDir(), "in.vcf")
+	if err := os.WriteFile(filename, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AnonymizeFile(filename, filepath.Join(filepath.Dir(filename), ".", "in.vcf"), "auto", export.HashPseudonymizer{Prefix: "WUE"}); err == nil {
+		t.Log("expected error for same input and output file")
+		t.Fail()
+	}
+	if actual, err := os.ReadFile(filename); err != nil || string(actual) != input {
+		t.Logf("input file was modified: %q (%v)", actual, err)
+		t.Fail()
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -21,6 +22,7 @@ const (
 )
 
 type Browser struct {
+	ctx            context.Context
 	db             *sql.DB
 	browserType    BrowserType
 	patientIds     []string
@@ -33,11 +35,12 @@ type Browser struct {
 	table      *tview.Table
 }
 
-func NewBrowser(patientIds []string, checkSampleIds bool, db *sql.DB) *Browser {
+func NewBrowser(ctx context.Context, patientIds []string, checkSampleIds bool, db *sql.DB) *Browser {
 	var inputField *tview.InputField
 	var dropDown *tview.DropDown
 
 	browser := &Browser{
+		ctx:            ctx,
 		db:             db,
 		browserType:    Patient,
 		patientIds:     patientIds,
@@ -155,13 +158,13 @@ func (browser *Browser) Show() {
 
 func (browser *Browser) saveTable(filename string) error {
 	if browser.browserType == Patient {
-		if data, err := FetchAllPatientData(browser.patientIds, browser.db); err == nil {
+		if data, err := FetchAllPatientData(browser.ctx, browser.patientIds, browser.db); err == nil {
 			return WriteFile(filename, data)
 		} else {
 			return err
 		}
 	} else if browser.browserType == Sample {
-		if data, err := FetchAllSampleData(browser.patientIds, browser.db); err == nil {
+		if data, err := FetchAllSampleData(browser.ctx, browser.patientIds, browser.db); err == nil {
 			return WriteFile(filename, data)
 		} else {
 			return err
@@ -202,7 +205,7 @@ func (browser *Browser) createTable(patientIds []string) (*tview.Table, error) {
 }
 
 func (browser *Browser) createPatientTable(patientIds []string) (*tview.Table, error) {
-	if data, err := FetchAllPatientData(patientIds, browser.db); err == nil {
+	if data, err := FetchAllPatientData(browser.ctx, patientIds, browser.db); err == nil {
 		table := tview.NewTable()
 		table.SetBorder(true)
 		table.SetBorders(true)
@@ -267,7 +270,7 @@ func (browser *Browser) createPatientTable(patientIds []string) (*tview.Table, e
 }
 
 func (browser *Browser) createSampleTable(patientIds []string) (*tview.Table, error) {
-	if data, err := FetchAllSampleData(patientIds, browser.db); err == nil {
+	if data, err := FetchAllSampleData(browser.ctx, patientIds, browser.db); err == nil {
 		table := tview.NewTable()
 		table.SetBorder(true)
 		table.SetBorders(true)
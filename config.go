@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// Parameter, die in einem Profil gespeichert werden können. Passwörter werden nie gespeichert.
+var profileFlags = []string{
+	"user", "host", "port", "socket", "database",
+	"ssl", "ssl-ca", "ssl-cert", "ssl-key", "ssl-server-name",
+	"ssh-host", "ssh-user", "ssh-key", "ssh-known-hosts",
+	"keyring", "id-prefix", "mtb-type", "pers-stamm",
+}
+
+// Verwaltung der Verbindungsprofile in der Konfigurationsdatei
+type ConfigCmd struct {
+	List struct {
+	} `cmd:"NA" help:"Zeigt alle Profile"`
+
+	Show struct {
+		Name string `arg:"" help:"Name des Profils"`
+	} `cmd:"NA" help:"Zeigt die Parameter eines Profils"`
+
+	Save struct {
+		Name string `arg:"" help:"Name des Profils"`
+	} `cmd:"NA" help:"Speichert die angegebenen Verbindungsparameter im Profil. Bestehende Parameter bleiben erhalten"`
+
+	Delete struct {
+		Name string `arg:"" help:"Name des Profils"`
+	} `cmd:"NA" help:"Löscht ein Profil"`
+}
+
+// Für die Verwaltung von Profilen sind weder Datenbankbenutzer noch Patienten erforderlich
+func (cmd *ConfigCmd) BeforeApply(kctx *kong.Context) error {
+	for _, flag := range kctx.Flags() {
+		flag.Required = false
+	}
+	return nil
+}
+
+// Pfad der Konfigurationsdatei im Home-Verzeichnis
+func configFilename() string {
+	homedir, _ := os.UserHomeDir()
+	return filepath.Join(homedir, ".osdb-config.json")
+}
+
+// Liest die Konfigurationsdatei. Existiert die Datei nicht, ist die Konfiguration leer.
+func readConfigFile(filename string) (map[string]any, error) {
+	values := map[string]any{}
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("config: Datei kann nicht gelesen werden: %w", err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("config: Ungültige Konfigurationsdatei '%s': %w", filename, err)
+	}
+	return values, nil
+}
+
+// Schreibt die Konfigurationsdatei, nur für den Besitzer les- und schreibbar
+func writeConfigFile(filename string, values map[string]any) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return errors.New("config: Fehler beim Erstellen der Konfiguration")
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("config: Datei kann nicht geschrieben werden: %w", err)
+	}
+	// Bestehende Dateien wurden früher für alle lesbar angelegt
+	if err := os.Chmod(filename, 0600); err != nil {
+		return fmt.Errorf("config: Dateirechte können nicht gesetzt werden: %w", err)
+	}
+	return nil
+}
+
+// Name eines Parameters in der Konfigurationsdatei, wie vom JSON-Resolver erwartet
+func configKey(flagName string) string {
+	return strings.ReplaceAll(flagName, "-", "_")
+}
+
+// Ermittelt alle Profile der Konfiguration
+func profiles(values map[string]any) map[string]any {
+	if result, ok := values["profiles"].(map[string]any); ok {
+		return result
+	}
+	return map[string]any{}
+}
+
+// Ermittelt das Profil mit dem angegebenen Namen
+func readProfile(filename string, name string) (map[string]any, error) {
+	values, err := readConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if profile, ok := profiles(values)[name].(map[string]any); ok {
+		return profile, nil
+	}
+	return nil, fmt.Errorf("Profil '%s' nicht gefunden", name)
+}
+
+// Resolver für die Parameter des mit '--profile' angegebenen Profils. Parameter des Profils haben Vorrang vor
+// allgemeinen Parametern der Konfigurationsdatei, auf der Kommandozeile angegebene Parameter haben Vorrang vor beiden.
+func profileResolver(filename string) kong.Resolver {
+	var profile map[string]any
+	return kong.ResolverFunc(func(kctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+		if flag.Name == "profile" || strings.HasPrefix(kctx.Command(), "config") {
+			return nil, nil
+		}
+		if profile == nil {
+			name := selectedProfile(kctx)
+			if len(name) == 0 {
+				return nil, nil
+			}
+			var err error
+			if profile, err = readProfile(filename, name); err != nil {
+				return nil, err
+			}
+		}
+		return profile[configKey(flag.Name)], nil
+	})
+}
+
+// Ermittelt den Namen des ausgewählten Profils
+func selectedProfile(kctx *kong.Context) string {
+	for _, flag := range kctx.Flags() {
+		if flag.Name == "profile" {
+			if name, ok := kctx.FlagValue(flag).(string); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Speichert Benutzername, Host, Port und Datenbank als allgemeine Parameter in der Konfigurationsdatei
+func saveDbConfig(filename string, cli *CLI) error {
+	values, err := readConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	values["user"] = cli.User
+	values["host"] = cli.Host
+	values["port"] = cli.Port
+	values["database"] = cli.Database
+	values["keyring"] = cli.Keyring
+	return writeConfigFile(filename, values)
+}
+
+// Führt den angegebenen 'config'-Befehl aus
+func configCommand(out io.Writer, filename string, kctx *kong.Context, cmd *ConfigCmd) error {
+	values, err := readConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	allProfiles := profiles(values)
+
+	switch kctx.Command() {
+	case "config list":
+		for _, name := range slices.Sorted(maps.Keys(allProfiles)) {
+			_, _ = fmt.Fprintln(out, name)
+		}
+		return nil
+	case "config show <name>":
+		profile, err := readProfile(filename, cmd.Show.Name)
+		if err != nil {
+			return err
+		}
+		data, _ := json.MarshalIndent(profile, "", "  ")
+		_, _ = fmt.Fprintln(out, string(data))
+		return nil
+	case "config save <name>":
+		profile, ok := allProfiles[cmd.Save.Name].(map[string]any)
+		if !ok {
+			profile = map[string]any{}
+		}
+		for _, trace := range kctx.Path {
+			if trace.Flag != nil && !trace.Resolved && slices.Contains(profileFlags, trace.Flag.Name) {
+				profile[configKey(trace.Flag.Name)] = kctx.FlagValue(trace.Flag)
+			}
+		}
+		if len(profile) == 0 {
+			return errors.New("config: Keine Parameter für das Profil angegeben, z.B. '--host'")
+		}
+		allProfiles[cmd.Save.Name] = profile
+		values["profiles"] = allProfiles
+		if err := writeConfigFile(filename, values); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "Profil '%s' in %s gespeichert\n", cmd.Save.Name, filename)
+		return nil
+	case "config delete <name>":
+		if _, ok := allProfiles[cmd.Delete.Name]; !ok {
+			return fmt.Errorf("Profil '%s' nicht gefunden", cmd.Delete.Name)
+		}
+		delete(allProfiles, cmd.Delete.Name)
+		values["profiles"] = allProfiles
+		return writeConfigFile(filename, values)
+	}
+	return nil
+}
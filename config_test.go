@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+const testConfig = `{
+  "user": "onkostar",
+  "host": "localhost",
+  "port": "3306",
+  "profiles": {
+    "prod": {"host": "db.example", "port": 3307, "mtb_type": "30", "id_prefix": "TEST", "pers_stamm": 5}
+  }
+}`
+
+func writeTestConfig(t *testing.T) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), ".osdb-config.json")
+	if err := os.WriteFile(filename, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func parseWithConfig(t *testing.T, filename string, args ...string) (*CLI, *kong.Context, error) {
+	t.Helper()
+
+	configCli := &CLI{}
+	parser, err := kong.New(configCli, kong.Name("os2cb"), kong.Configuration(kong.JSON, filename), kong.Resolvers(profileResolver(filename)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kctx, err := parser.Parse(args)
+	return configCli, kctx, err
+}
+
+func TestShouldUseProfileParameters(t *testing.T) {
+	filename := writeTestConfig(t)
+
+	actual, _, err := parseWithConfig(t, filename, "--profile", "prod", "--mtb-type", "25", "--all", "export-samples", "--filename", "samples.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.User != "onkostar" || actual.Host != "db.example" || actual.Port != 3307 || actual.IDPrefix != "TEST" || !slices.Equal(actual.MtbType, []string{"25"}) || !slices.Equal(actual.PersStamm, []int{5}) {
+		t.Logf("wrong parameters: user %s, host %s, port %d, prefix %s, mtb type %v, pers stamm %v", actual.User, actual.Host, actual.Port, actual.IDPrefix, actual.MtbType, actual.PersStamm)
+		t.Fail()
+	}
+}
+
+func TestShouldUseConfigWithoutProfile(t *testing.T) {
+	filename := writeTestConfig(t)
+
+	actual, _, err := parseWithConfig(t, filename, "--all", "export-samples", "--filename", "samples.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.Host != "localhost" || actual.Port != 3306 || !slices.Equal(actual.MtbType, []string{"27"}) {
+		t.Logf("wrong parameters: host %s, port %d, mtb type %v", actual.Host, actual.Port, actual.MtbType)
+		t.Fail()
+	}
+}
+
+func TestShouldFailForUnknownProfile(t *testing.T) {
+	filename := writeTestConfig(t)
+
+	if _, _, err := parseWithConfig(t, filename, "--profile", "other", "--all", "export-samples", "--filename", "samples.tsv"); err == nil {
+		t.Log("expected error for unknown profile")
+		t.Fail()
+	}
+}
+
+func TestShouldSaveAndDeleteProfile(t *testing.T) {
+	filename := writeTestConfig(t)
+
+	configCli, kctx, err := parseWithConfig(t, filename, "config", "save", "test", "--host", "test.example", "--pers-stamm", "2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configCommand(&bytes.Buffer{}, filename, kctx, &configCli.Config); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := readProfile(filename, "test")
+	if err != nil || len(profile) != 2 || profile["host"] != "test.example" || fmt.Sprint(profile["pers_stamm"]) != "[2 3]" {
+		t.Logf("wrong profile: %v, %v", profile, err)
+		t.Fail()
+	}
+	if info, _ := os.Stat(filename); info.Mode().Perm() != 0600 {
+		t.Logf("wrong permissions: %v", info.Mode().Perm())
+		t.Fail()
+	}
+
+	if profileCli, _, err := parseWithConfig(t, filename, "--profile", "test", "--all", "export-samples", "--filename", "samples.tsv"); err != nil || !slices.Equal(profileCli.PersStamm, []int{2, 3}) {
+		t.Logf("wrong pers stamm from saved profile: %v (%v)", profileCli.PersStamm, err)
+		t.Fail()
+	}
+
+	configCli, kctx, _ = parseWithConfig(t, filename, "config", "delete", "test")
+	if err := configCommand(&bytes.Buffer{}, filename, kctx, &configCli.Config); err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	configCli, kctx, _ = parseWithConfig(t, filename, "config", "list")
+	if err := configCommand(&out, filename, kctx, &configCli.Config); err != nil || strings.TrimSpace(out.String()) != "prod" {
+		t.Logf("wrong profiles: %s, %v", out.String(), err)
+		t.Fail()
+	}
+}
+
+func TestShouldSaveDbConfigAsJson(t *testing.T) {
+	filename := writeTestConfig(t)
+
+	if err := saveDbConfig(filename, &CLI{Globals: Globals{User: "admin", Host: "db\\example", Port: 3308, Database: "onkostar"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readConfigFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["port"] != float64(3308) || values["host"] != "db\\example" || len(profiles(values)) != 1 {
+		t.Logf("wrong config: %v", values)
+		t.Fail()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// Name des Dienstes, unter dem das Passwort im Schlüsselbund des Betriebssystems gespeichert wird
+const keyringService = "os2cb"
+
+// Ermittelt das Passwort für den Datenbankzugriff in folgender Reihenfolge: '--password-file', '--password' bzw.
+// Umgebungsvariable OS2CB_PASSWORD, Schlüsselbund des Betriebssystems (mit '--keyring') und zuletzt die Eingabeaufforderung.
+func resolvePassword(cli *CLI) (string, error) {
+	if len(cli.PasswordFile) > 0 {
+		return readPasswordFile(cli.PasswordFile)
+	}
+	if len(cli.Password) > 0 {
+		return cli.Password, nil
+	}
+	if cli.Keyring {
+		password, err := keyring.Get(keyringService, keyringUser(cli))
+		if err == nil {
+			return password, nil
+		}
+		if !errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("keyring: Passwort kann nicht gelesen werden: %w", err)
+		}
+	}
+	return promptPassword()
+}
+
+// Liest das Passwort aus der ersten Zeile der Datei. Die Datei darf nur für den Besitzer lesbar sein.
+func readPasswordFile(filename string) (string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", fmt.Errorf("password-file: Datei kann nicht gelesen werden: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("password-file: Datei '%s' darf nur für den Besitzer lesbar sein (chmod 600)", filename)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("password-file: Datei kann nicht gelesen werden: %w", err)
+	}
+	password, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSuffix(password, "\r"), nil
+}
+
+// Speichert das Passwort im Schlüsselbund des Betriebssystems
+func savePasswordToKeyring(cli *CLI) error {
+	if err := keyring.Set(keyringService, keyringUser(cli), cli.Password); err != nil {
+		return fmt.Errorf("keyring: Passwort kann nicht gespeichert werden: %w", err)
+	}
+	return nil
+}
+
+// Eintrag im Schlüsselbund je Benutzer und Datenbank
+func keyringUser(cli *CLI) string {
+	if len(cli.Socket) > 0 {
+		return fmt.Sprintf("%s@%s/%s", cli.User, cli.Socket, cli.Database)
+	}
+	return fmt.Sprintf("%s@%s:%d/%s", cli.User, cli.Host, cli.Port, cli.Database)
+}
+
+// Fragt das Passwort interaktiv ab. Ist keine Eingabe möglich, wird ein leeres Passwort verwendet.
+func promptPassword() (string, error) {
+	fmt.Print("Passwort: ")
+	defer println()
+	if password, err := term.ReadPassword(int(syscall.Stdin)); err == nil {
+		return string(password), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/zalando/go-keyring"
+)
+
+func writePasswordFile(t *testing.T, content string, perm os.FileMode) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(filename, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filename, perm); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestShouldReadPasswordFile(t *testing.T) {
+	filename := writePasswordFile(t, "geheim\r\nweitere Zeile\n", 0600)
+
+	actual, err := resolvePassword(&CLI{Globals: Globals{Password: "other", PasswordFile: filename}})
+	if err != nil || actual != "geheim" {
+		t.Logf("wrong password: Expected 'geheim', got '%s' (%v)", actual, err)
+		t.Fail()
+	}
+}
+
+func TestShouldRejectReadablePasswordFile(t *testing.T) {
+	filename := writePasswordFile(t, "geheim\n", 0644)
+
+	if _, err := resolvePassword(&CLI{Globals: Globals{PasswordFile: filename}}); err == nil {
+		t.Log("expected error for password file readable by others")
+		t.Fail()
+	}
+}
+
+func TestShouldUsePasswordFromEnv(t *testing.T) {
+	t.Setenv("OS2CB_PASSWORD", "geheim")
+
+	envCli := &CLI{}
+	parser, err := kong.New(envCli, kong.Name("os2cb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Parse([]string{"--user", "root", "--all", "export-samples", "--filename", "samples.tsv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual, _ := resolvePassword(envCli); actual != "geheim" {
+		t.Logf("wrong password: Expected 'geheim', got '%s'", actual)
+		t.Fail()
+	}
+}
+
+func TestShouldUsePasswordFromKeyring(t *testing.T) {
+	keyring.MockInit()
+	keyringCli := &CLI{Globals: Globals{User: "onkostar", Host: "db.example", Port: 3306, Database: "onkostar", Password: "geheim", Keyring: true}}
+	if err := savePasswordToKeyring(keyringCli); err != nil {
+		t.Fatal(err)
+	}
+
+	keyringCli.Password = ""
+	if actual, err := resolvePassword(keyringCli); err != nil || actual != "geheim" {
+		t.Logf("wrong password: Expected 'geheim', got '%s' (%v)", actual, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,292 @@
+// Package export ermittelt Patienten- und Probendaten aus einer Onkostar-Datenbank für den Import in cBioportal.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Standardanzahl der Patienten, deren Daten gemeinsam abgefragt werden
+const DefaultChunkSize = 500
+
+// Standardanzahl paralleler Abfragen
+const DefaultWorkers = 4
+
+// Standardwert des MTB-Typs der Tumorkonferenz in Onkostar
+const DefaultMtbType = "27"
+
+// Standardanzahl Wiederholungen einer Abfrage bei vorübergehenden Datenbankfehlern
+const DefaultRetries = 3
+
+// Konfiguration eines Exports
+type Config struct {
+	// MTB-Typen der Tumorkonferenz in Onkostar, z.B. '27'. Standard ist DefaultMtbType.
+	MtbTypes []string
+	// Erlaube Diagnosen mit allen Tumorkonferenzen, nicht nur Diagnosen mit MTBs
+	AllTk bool
+	// Auswahl der Patienten und Proben anhand Panel oder Art der Sequenzierung
+	Filter SampleFilter
+	// IDs der Personenstämme, in denen Patienten gesucht werden. Ohne Angabe alle Personenstämme.
+	PersStamm []int
+	// Zeitraum, in dem Untersuchung, MTB oder Diagnose liegen müssen. Gilt für die Auswahl der Patienten und Proben,
+	// nicht für Patientendaten.
+	DateRange DateRange
+	// Anfänge von ICD-10-Codes der Diagnosen einer Erkrankung, z.B. 'C34'. Ohne Angabe alle Erkrankungen.
+	Icd10 []string
+	// Anfänge von ICD-O-3-Morphologiecodes der Diagnosen einer Erkrankung, z.B. '8140/3'. Ohne Angabe alle Erkrankungen.
+	Morphology []string
+	// Anzahl Patienten, deren Daten gemeinsam abgefragt werden. Standard ist DefaultChunkSize.
+	ChunkSize int
+	// Anzahl paralleler Abfragen. Standard ist DefaultWorkers, begrenzt durch die maximale Anzahl
+	// Datenbankverbindungen. Bei 1 erfolgen alle Abfragen nacheinander.
+	Workers int
+	// Maximale Dauer einer einzelnen Datenbankabfrage. Ohne Angabe unbegrenzt.
+	QueryTimeout time.Duration
+	// Anzahl Wiederholungen einer Abfrage bei vorübergehenden Datenbankfehlern, z.B. Verbindungsabbruch.
+	// Bei 0 erfolgt keine Wiederholung, ebenso bei NewTxExporter.
+	Retries int
+	// Wartezeit vor der ersten Wiederholung, verdoppelt sich mit jeder weiteren. Standard ist DefaultRetryDelay.
+	RetryDelay time.Duration
+}
+
+// Fehler beim Ermitteln der Daten eines einzelnen Patienten
+type PatientError struct {
+	PatientID string
+	Err       error
+}
+
+func (err *PatientError) Error() string {
+	return fmt.Sprintf("Patient '%s': %s", err.PatientID, err.Err.Error())
+}
+
+func (err *PatientError) Unwrap() error {
+	return err.Err
+}
+
+// Exportiert Patienten- und Probendaten aus Onkostar
+type Exporter struct {
+	config        Config
+	source        OnkostarSource
+	pseudonymizer Pseudonymizer
+	retried       *retryLog
+}
+
+// Erstellt einen Exporter mit Zugriff auf eine Onkostar-Datenbank
+func NewExporter(config Config, db *sql.DB, pseudonymizer Pseudonymizer) *Exporter {
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if maxOpenConnections := db.Stats().MaxOpenConnections; maxOpenConnections > 0 {
+		config.Workers = min(config.Workers, maxOpenConnections)
+	}
+	return NewExporterWithSource(config, NewSQLSource(db, config.QueryTimeout).WithPersStamm(config.PersStamm).WithChunkSize(config.ChunkSize), pseudonymizer)
+}
+
+// Erstellt einen Exporter, der alle Abfragen in einer Transaktion (siehe BeginConsistentRead) nacheinander ausführt.
+// Die Transaktion muss vom Aufrufer beendet werden. Abfragen werden nicht wiederholt, da die Verbindung der Transaktion
+// nach einem Verbindungsabbruch nicht mehr verwendbar ist und eine Wiederholung außerhalb des Datenstands erfolgen würde.
+func NewTxExporter(config Config, tx *sql.Tx, pseudonymizer Pseudonymizer) *Exporter {
+	config.Workers = 1
+	config.Retries = 0
+	return NewExporterWithSource(config, NewSQLSourceTx(tx, config.QueryTimeout).WithPersStamm(config.PersStamm).WithChunkSize(config.ChunkSize), pseudonymizer)
+}
+
+// Erstellt einen Exporter mit beliebiger Datenquelle
+func NewExporterWithSource(config Config, source OnkostarSource, pseudonymizer Pseudonymizer) *Exporter {
+	if pseudonymizer == nil {
+		pseudonymizer = NoPseudonymizer{}
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultChunkSize
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = DefaultRetryDelay
+	}
+	if len(config.MtbTypes) == 0 {
+		config.MtbTypes = []string{DefaultMtbType}
+	}
+	return &Exporter{
+		config:        config,
+		source:        source,
+		pseudonymizer: pseudonymizer,
+		retried:       &retryLog{},
+	}
+}
+
+// Ermittelt die IDs aller Patienten mit Molekulargenetik entsprechend dem konfigurierten Filter und Zeitraum
+func (exporter *Exporter) FetchPatientIds(ctx context.Context) ([]string, error) {
+	return retry(ctx, exporter, nil, func() ([]string, error) {
+		return exporter.source.PatientIds(ctx, exporter.selection())
+	})
+}
+
+// Auswahl von Patienten und Proben entsprechend der Konfiguration
+func (exporter *Exporter) selection() Selection {
+	return Selection{
+		Filter:     exporter.config.Filter,
+		MtbTypes:   exporter.config.MtbTypes,
+		DateRange:  exporter.config.DateRange,
+		Icd10:      exporter.config.Icd10,
+		Morphology: exporter.config.Morphology,
+	}
+}
+
+// Liefert die IDs aller Patienten, deren Abfragen wegen vorübergehender Datenbankfehler wiederholt wurden,
+// unabhängig davon, ob die Wiederholung erfolgreich war
+func (exporter *Exporter) RetriedPatients() []string {
+	return exporter.retried.patients()
+}
+
+// Stammdaten und Diagnosen eines Patienten
+type patientRecords struct {
+	record    PatientRecord
+	diagnoses DiagnosesRecord
+}
+
+// Ermittelt alle Patientendaten von allen angegebenen Patienten, sortiert nach Patienten-ID.
+// Fehler einzelner Patienten werden wie bei FetchSampleData als PatientError zusammengefasst zurückgegeben.
+func (exporter *Exporter) FetchPatientData(ctx context.Context, patientIds []string) ([]PatientData, error) {
+	records, err := processChunks(ctx, patientIds, exporter.config.ChunkSize, exporter.config.Workers, exporter.fetchPatients)
+
+	slices.SortFunc(records, func(a, b patientRecords) int {
+		return strings.Compare(a.record.PatientID, b.record.PatientID)
+	})
+
+	result := []PatientData{}
+	for _, records := range records {
+		result = append(result, mapPatient(records.record, records.diagnoses, exporter.pseudonymizer))
+	}
+	return result, err
+}
+
+// Ermittelt Stammdaten und Diagnosen für einen Teil der Patienten
+func (exporter *Exporter) fetchPatients(ctx context.Context, patientIds []string) ([]patientRecords, error) {
+	records, err := retry(ctx, exporter, patientIds, func() ([]PatientRecord, error) {
+		return exporter.source.Patients(ctx, patientIds, exporter.config.MtbTypes)
+	})
+	if err != nil && !onlyPatientErrors(err) {
+		return nil, chunkError(patientIds, err)
+	}
+	patientsErr := err
+
+	diagnoses, err := retry(ctx, exporter, patientIds, func() (map[string]DiagnosesRecord, error) {
+		return exporter.source.Diagnoses(ctx, patientIds, exporter.config.MtbTypes, exporter.config.AllTk)
+	})
+	if err != nil {
+		return nil, chunkError(patientIds, err)
+	}
+
+	var result []patientRecords
+	found := map[string]bool{}
+	for _, record := range records {
+		found[record.PatientID] = true
+		result = append(result, patientRecords{record: record, diagnoses: diagnoses[record.PatientID]})
+	}
+	for _, patientErr := range PatientErrors(patientsErr) {
+		found[patientErr.PatientID] = true
+	}
+
+	errs := []error{patientsErr}
+	for _, patientID := range patientIds {
+		if !found[patientID] {
+			errs = append(errs, &PatientError{PatientID: patientID, Err: fmt.Errorf("keine Daten zu Patient mit ID '%s'", patientID)})
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// Ermittelt alle Probendaten von allen angegebenen Patienten.
+// Fehler einzelner Patienten werden als PatientError zusammengefasst zurückgegeben, die Daten
+// aller anderen Patienten sind dennoch im Ergebnis enthalten.
+func (exporter *Exporter) FetchSampleData(ctx context.Context, patientIds []string) ([]SampleData, error) {
+	return processChunks(ctx, patientIds, exporter.config.ChunkSize, exporter.config.Workers, exporter.fetchSamples)
+}
+
+// Ermittelt Patienten- und Probendaten parallel, bei nur einem Worker nacheinander.
+// Fehler einzelner Patienten werden für Patienten- und Probendaten gemeinsam zurückgegeben, die Daten
+// aller anderen Patienten sind dennoch im Ergebnis enthalten.
+func (exporter *Exporter) FetchAll(ctx context.Context, patientIds []string) ([]PatientData, []SampleData, error) {
+	if exporter.config.Workers == 1 {
+		patients, patientsErr := exporter.FetchPatientData(ctx, patientIds)
+		samples, samplesErr := exporter.FetchSampleData(ctx, patientIds)
+		return patients, samples, errors.Join(patientsErr, samplesErr)
+	}
+
+	var patients []PatientData
+	var patientsErr error
+
+	wg := sync.WaitGroup{}
+	wg.Go(func() {
+		patients, patientsErr = exporter.FetchPatientData(ctx, patientIds)
+	})
+	samples, samplesErr := exporter.FetchSampleData(ctx, patientIds)
+	wg.Wait()
+
+	return patients, samples, errors.Join(patientsErr, samplesErr)
+}
+
+// Ermittelt die Probendaten für einen Teil der Patienten mit wenigen Abfragen
+func (exporter *Exporter) fetchSamples(ctx context.Context, patientIds []string) ([]SampleData, error) {
+	procedures, err := retry(ctx, exporter, patientIds, func() (map[string][]MolecularRecord, error) {
+		return exporter.source.MolecularProcedures(ctx, patientIds, exporter.selection())
+	})
+	if err != nil && !onlyPatientErrors(err) {
+		return nil, chunkError(patientIds, err)
+	}
+	errs := []error{err}
+	failed := map[string]bool{}
+	for _, patientErr := range PatientErrors(err) {
+		failed[patientErr.PatientID] = true
+	}
+
+	var prozedurIds []string
+	for _, records := range procedures {
+		for _, record := range records {
+			prozedurIds = append(prozedurIds, record.ProzedurID)
+		}
+	}
+
+	biomarkers, err := retry(ctx, exporter, patientIds, func() (map[string]BiomarkerRecord, error) {
+		return exporter.source.Biomarkers(ctx, prozedurIds)
+	})
+	if err != nil {
+		return nil, chunkError(patientIds, err)
+	}
+
+	var result []SampleData
+	for _, patientID := range patientIds {
+		if failed[patientID] {
+			continue
+		}
+		records, exists := procedures[patientID]
+		if !exists {
+			errs = append(errs, &PatientError{PatientID: patientID, Err: fmt.Errorf("keine Daten zu Patient mit ID '%s'", patientID)})
+			continue
+		}
+		for _, record := range records {
+			if !matchesFilter(record, exporter.config.Filter) || record.Einsendenummer == nil {
+				continue
+			}
+			result = append(result, mapSample(patientID, record, biomarkers[record.ProzedurID], exporter.pseudonymizer))
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// Fehler für alle Patienten eines Teils der Patienten
+func chunkError(patientIds []string, err error) error {
+	var errs []error
+	for _, patientID := range patientIds {
+		errs = append(errs, &PatientError{PatientID: patientID, Err: err})
+	}
+	return errors.Join(errs...)
+}
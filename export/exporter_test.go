@@ -0,0 +1,225 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func value(s string) *string {
+	return &s
+}
+
+func testSource() *MemorySource {
+	alter := 63
+	return &MemorySource{
+		Data: []MemoryPatient{
+			{
+				PatientRecord: PatientRecord{PatientID: "2000123", Geschlecht: value("w"), Alter: &alter, Karnofsky: value("70%")},
+				Diagnoses: DiagnosesRecord{
+					Main: &DiagnosisRecord{Icd10: value("C34.1"), Diagnose: value("Bösartige Neubildung: Oberlappen"), Fernmetastasen: value("1")},
+					All:  []string{"Bösartige Neubildung: Oberlappen", "Bösartige Neubildung: Prostata"},
+				},
+				Procedures: []MemoryProcedure{
+					{
+						MolecularRecord: MolecularRecord{ProzedurID: "11", Einsendenummer: value("H/2024/1234"), Nukleinsaeure: value("dnarna"), PanelCode: value("OCAPlus"), Panel: value("OCA Plus"), Artdersequenzierung: value("PanelSeq")},
+						Biomarkers: BiomarkerRecord{
+							Immunhisto: &ImmunhistoRecord{Gen: value("PDL1"), Tps: value("50")},
+							Hrd:        []HrdRecord{{Score: value("42"), Loh: value("7")}},
+						},
+					},
+					{
+						MolecularRecord: MolecularRecord{ProzedurID: "12", Einsendenummer: value("H/2024/2345"), Nukleinsaeure: value("dna"), PanelCode: value("TSO500"), Panel: value("TSO 500"), Artdersequenzierung: value("WES")},
+						Biomarkers: BiomarkerRecord{
+							Hrd: []HrdRecord{{Score: value("23")}},
+							Tmb: []string{"12.5"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestShouldMapPatientData(t *testing.T) {
+	exporter := NewExporterWithSource(Config{MtbTypes: []string{"27"}}, testSource(), nil)
+
+	actual, err := exporter.FetchPatientData(t.Context(), []string{"2000123"})
+	if err != nil || len(actual) != 1 {
+		t.Logf("unexpected result: %v, %v", actual, err)
+		t.FailNow()
+	}
+
+	expected := PatientData{
+		ID:                   "2000123",
+		Gender:               "Female",
+		Sex:                  "Female",
+		Age:                  "63",
+		Diagnosis:            "Boesartige Neubildung: Oberlappen",
+		OncotreeCode:         "NA",
+		Icd10Code:            "C34.1",
+		MtbEcogStatus:        "1",
+		PastMalignantDisease: "Boesartige Neubildung: Oberlappen + Boesartige Neubildung: Prostata",
+		OsStatus:             "LIVING",
+		DfsStatus:            "NA",
+		DfsMonths:            "NA",
+	}
+	if actual[0] != expected {
+		t.Logf("wrong patient data: Expected %v, got %v", expected, actual[0])
+		t.Fail()
+	}
+}
+
+func TestShouldSplitGimAndHrdScore(t *testing.T) {
+	exporter := NewExporterWithSource(Config{}, testSource(), HashPseudonymizer{Prefix: "WUE"})
+
+	actual, err := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+	if err != nil || len(actual) != 2 {
+		t.Logf("unexpected result: %v, %v", actual, err)
+		t.FailNow()
+	}
+
+	if actual[0].GimScore != "42" || actual[0].HrdScore != "NA" || actual[0].HrdLoh != "7" {
+		t.Logf("wrong OCAPlus scores: GIM %s, HRD %s, LOH %s", actual[0].GimScore, actual[0].HrdScore, actual[0].HrdLoh)
+		t.Fail()
+	}
+	if actual[1].GimScore != "NA" || actual[1].HrdScore != "23" || actual[1].TmbScore != "12.5" {
+		t.Logf("wrong scores: GIM %s, HRD %s, TMB %s", actual[1].GimScore, actual[1].HrdScore, actual[1].TmbScore)
+		t.Fail()
+	}
+	if actual[0].Tps != "50" || actual[1].Tps != "NA" {
+		t.Logf("wrong TPS: %s, %s", actual[0].Tps, actual[1].Tps)
+		t.Fail()
+	}
+}
+
+func TestShouldApplyPanelAndPlatformRules(t *testing.T) {
+	exporter := NewExporterWithSource(Config{}, testSource(), HashPseudonymizer{Prefix: "WUE"})
+
+	actual, _ := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+
+	if actual[0].SampleID != "WUE_e7a1d73956" {
+		t.Logf("wrong sample id: %s", actual[0].SampleID)
+		t.Fail()
+	}
+	if actual[0].SequencingDnaPanel != "OCA Plus" || actual[0].FusionRnaPanel != "OCA Plus" {
+		t.Logf("wrong panels: %s, %s", actual[0].SequencingDnaPanel, actual[0].FusionRnaPanel)
+		t.Fail()
+	}
+	if actual[0].SequencingDnaPlatform != "Thermo Fisher" || actual[0].SequencingRnaPlatform != "Thermo Fisher" {
+		t.Logf("wrong platforms: %s, %s", actual[0].SequencingDnaPlatform, actual[0].SequencingRnaPlatform)
+		t.Fail()
+	}
+	if actual[1].FusionRnaPanel != "NA" || actual[1].SequencingDnaPlatform != "NA" {
+		t.Logf("wrong values for unknown panel: %s, %s", actual[1].FusionRnaPanel, actual[1].SequencingDnaPlatform)
+		t.Fail()
+	}
+}
+
+func TestShouldNotApplyPlatformWithoutPrefix(t *testing.T) {
+	exporter := NewExporterWithSource(Config{}, testSource(), nil)
+
+	actual, _ := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+
+	if actual[0].SequencingDnaPlatform != "NA" {
+		t.Logf("wrong platform: %s", actual[0].SequencingDnaPlatform)
+		t.Fail()
+	}
+}
+
+func TestShouldFilterSamples(t *testing.T) {
+	source := testSource()
+
+	for filter, expected := range map[SampleFilter]int{None: 2, OcaPlusOnly: 1, WesOnly: 1, WgsOnly: 0} {
+		exporter := NewExporterWithSource(Config{Filter: filter}, source, nil)
+		actual, _ := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+		if len(actual) != expected {
+			t.Logf("wrong sample count for filter %d: Expected %d, got %d", filter, expected, len(actual))
+			t.Fail()
+		}
+		ids, _ := exporter.FetchPatientIds(t.Context())
+		if (expected > 0) != (len(ids) == 1) {
+			t.Logf("wrong patient ids for filter %d: %v", filter, ids)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldReturnPatientErrorForUnknownPatient(t *testing.T) {
+	exporter := NewExporterWithSource(Config{}, testSource(), nil)
+
+	actual, err := exporter.FetchSampleData(t.Context(), []string{"2000123", "2000999"})
+
+	var patientErr *PatientError
+	if !errors.As(err, &patientErr) || patientErr.PatientID != "2000999" {
+		t.Logf("expected patient error, got %v", err)
+		t.Fail()
+	}
+	if len(actual) != 2 {
+		t.Logf("expected samples of known patient, got %d", len(actual))
+		t.Fail()
+	}
+}
+
+// Datenquelle, bei der die Abfrage der Diagnosen für einen Patienten fehlschlägt
+type failingDiagnosesSource struct {
+	*MemorySource
+	patientID string
+}
+
+func (source *failingDiagnosesSource) Diagnoses(ctx context.Context, patientIds []string, mtbTypes []string, allTk bool) (map[string]DiagnosesRecord, error) {
+	if slices.Contains(patientIds, source.patientID) {
+		return nil, errors.New("test")
+	}
+	return source.MemorySource.Diagnoses(ctx, patientIds, mtbTypes, allTk)
+}
+
+func TestShouldReturnPatientDataOfOtherChunks(t *testing.T) {
+	memorySource := testSource()
+	memorySource.Data = append(memorySource.Data, MemoryPatient{PatientRecord: PatientRecord{PatientID: "2000456"}})
+	source := &failingDiagnosesSource{MemorySource: memorySource, patientID: "2000456"}
+	exporter := NewExporterWithSource(Config{ChunkSize: 1}, source, nil)
+
+	actual, err := exporter.FetchPatientData(t.Context(), []string{"2000123", "2000456"})
+
+	patientErrors := PatientErrors(err)
+	if len(patientErrors) != 1 || patientErrors[0].PatientID != "2000456" {
+		t.Logf("expected patient error, got %v", err)
+		t.Fail()
+	}
+	if len(actual) != 1 || actual[0].ID != "2000123" {
+		t.Logf("expected patient data of other chunk, got %v", actual)
+		t.Fail()
+	}
+
+	patients, samples, err := exporter.FetchAll(t.Context(), []string{"2000123", "2000456"})
+	if len(patients) != 1 || len(samples) != 2 || len(PatientErrors(err)) != 1 {
+		t.Logf("wrong result: %d patients, %d samples, %v", len(patients), len(samples), err)
+		t.Fail()
+	}
+}
+
+func TestShouldReadWrittenSnapshot(t *testing.T) {
+	snapshot, err := NewSnapshot(t.Context(), testSource(), Config{MtbTypes: []string{"27"}, ChunkSize: 1}, []string{"2000123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	if err := snapshot.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := ReadSnapshot(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := NewExporterWithSource(Config{}, testSource(), nil).FetchSampleData(t.Context(), []string{"2000123"})
+	samples, _ := NewExporterWithSource(Config{}, actual, nil).FetchSampleData(t.Context(), []string{"2000123"})
+	if len(samples) != len(expected) || samples[0] != expected[0] || samples[1] != expected[1] {
+		t.Logf("wrong samples from snapshot: Expected %v, got %v", expected, samples)
+		t.Fail()
+	}
+}
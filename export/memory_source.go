@@ -0,0 +1,175 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Datenquelle mit Daten im Arbeitsspeicher, z.B. für Tests oder als Snapshot einer Onkostar-Datenbank.
+// Die Daten der Patienten sind für einen MTB-Typ, die Auswahl der Tumorkonferenzen und die Personenstämme bereits
+// ermittelt, entsprechende Angaben beim Abruf werden daher ignoriert. Ein Zeitraum wird nur für das Datum der
+// Untersuchung angewendet, die Auswahl nach Diagnosen einer Erkrankung ist im Snapshot bereits angewendet.
+type MemorySource struct {
+	Data []MemoryPatient `json:"patients"`
+}
+
+// Daten eines Patienten in einer MemorySource
+type MemoryPatient struct {
+	PatientRecord
+	Diagnoses  DiagnosesRecord   `json:"diagnoses"`
+	Procedures []MemoryProcedure `json:"procedures"`
+}
+
+// Molekulargenetische Untersuchung mit Biomarkern in einer MemorySource
+type MemoryProcedure struct {
+	MolecularRecord
+	Biomarkers BiomarkerRecord `json:"biomarkers"`
+}
+
+// Erstellt einen Snapshot der angegebenen Patienten aus einer anderen Datenquelle.
+// Verwendet werden MTB-Typ, Auswahl der Tumorkonferenzen, Zeitraum, Diagnosen und Anzahl Patienten je Abfrage der
+// Konfiguration.
+func NewSnapshot(ctx context.Context, source OnkostarSource, config Config, patientIds []string) (*MemorySource, error) {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultChunkSize
+	}
+	if len(config.MtbTypes) == 0 {
+		config.MtbTypes = []string{DefaultMtbType}
+	}
+
+	snapshot := &MemorySource{}
+	for chunk := range slices.Chunk(patientIds, config.ChunkSize) {
+		records, err := source.Patients(ctx, chunk, config.MtbTypes)
+		if err != nil {
+			return nil, err
+		}
+
+		diagnoses, err := source.Diagnoses(ctx, chunk, config.MtbTypes, config.AllTk)
+		if err != nil {
+			return nil, err
+		}
+
+		procedures, err := source.MolecularProcedures(ctx, chunk, Selection{MtbTypes: config.MtbTypes, DateRange: config.DateRange, Icd10: config.Icd10, Morphology: config.Morphology})
+		if err != nil {
+			return nil, err
+		}
+
+		var prozedurIds []string
+		for _, records := range procedures {
+			for _, record := range records {
+				prozedurIds = append(prozedurIds, record.ProzedurID)
+			}
+		}
+		biomarkers, err := source.Biomarkers(ctx, prozedurIds)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			patient := MemoryPatient{PatientRecord: record, Diagnoses: diagnoses[record.PatientID]}
+			for _, procedure := range procedures[record.PatientID] {
+				patient.Procedures = append(patient.Procedures, MemoryProcedure{MolecularRecord: procedure, Biomarkers: biomarkers[procedure.ProzedurID]})
+			}
+			snapshot.Data = append(snapshot.Data, patient)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Liest einen Snapshot im JSON-Format
+func ReadSnapshot(in io.Reader) (*MemorySource, error) {
+	snapshot := &MemorySource{}
+	if err := json.NewDecoder(in).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// Schreibt den Snapshot im JSON-Format
+func (source *MemorySource) Write(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(source)
+}
+
+func (source *MemorySource) patient(patientID string) *MemoryPatient {
+	for i := range source.Data {
+		if source.Data[i].PatientID == patientID {
+			return &source.Data[i]
+		}
+	}
+	return nil
+}
+
+func (source *MemorySource) PatientIds(_ context.Context, selection Selection) ([]string, error) {
+	var result []string
+	for _, patient := range source.Data {
+		if slices.ContainsFunc(patient.Procedures, func(procedure MemoryProcedure) bool {
+			return matchesFilter(procedure.MolecularRecord, selection.Filter) && source.matchesDateRange(procedure.MolecularRecord, selection.DateRange)
+		}) {
+			result = append(result, patient.PatientID)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+func (source *MemorySource) Patients(_ context.Context, patientIds []string, _ []string) ([]PatientRecord, error) {
+	var result []PatientRecord
+	for _, patient := range source.Data {
+		if slices.Contains(patientIds, patient.PatientID) {
+			result = append(result, patient.PatientRecord)
+		}
+	}
+	slices.SortFunc(result, func(a, b PatientRecord) int {
+		return strings.Compare(a.PatientID, b.PatientID)
+	})
+	return result, nil
+}
+
+func (source *MemorySource) Diagnoses(_ context.Context, patientIds []string, _ []string, _ bool) (map[string]DiagnosesRecord, error) {
+	result := map[string]DiagnosesRecord{}
+	for _, patientID := range patientIds {
+		if patient := source.patient(patientID); patient != nil {
+			result[patientID] = patient.Diagnoses
+		}
+	}
+	return result, nil
+}
+
+func (source *MemorySource) MolecularProcedures(_ context.Context, patientIds []string, selection Selection) (map[string][]MolecularRecord, error) {
+	result := map[string][]MolecularRecord{}
+	for _, patientID := range patientIds {
+		if patient := source.patient(patientID); patient != nil {
+			result[patientID] = []MolecularRecord{}
+			for _, procedure := range patient.Procedures {
+				if source.matchesDateRange(procedure.MolecularRecord, selection.DateRange) {
+					result[patientID] = append(result[patientID], procedure.MolecularRecord)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// Prüft das Datum der Untersuchung. Zeiträume für MTB oder Diagnose sind im Snapshot bereits angewendet.
+func (source *MemorySource) matchesDateRange(record MolecularRecord, dateRange DateRange) bool {
+	return dateRange.Field != SequencingDate || dateRange.contains(record.Datum)
+}
+
+func (source *MemorySource) Biomarkers(_ context.Context, prozedurIds []string) (map[string]BiomarkerRecord, error) {
+	result := map[string]BiomarkerRecord{}
+	for _, patient := range source.Data {
+		for _, procedure := range patient.Procedures {
+			if slices.Contains(prozedurIds, procedure.ProzedurID) {
+				result[procedure.ProzedurID] = procedure.Biomarkers
+			}
+		}
+	}
+	return result, nil
+}
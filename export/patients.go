@@ -0,0 +1,214 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func sanitizeUmlaute(s string) string {
+	s = strings.ReplaceAll(s, "Ä", "Ae")
+	s = strings.ReplaceAll(s, "Ö", "Oe")
+	s = strings.ReplaceAll(s, "Ü", "Ue")
+	s = strings.ReplaceAll(s, "ä", "ae")
+	s = strings.ReplaceAll(s, "ö", "oe")
+	s = strings.ReplaceAll(s, "ü", "ue")
+	s = strings.ReplaceAll(s, "ß", "ss")
+	return s
+}
+
+// Bildet Stammdaten und Diagnosen eines Patienten auf Patientendaten ab
+func mapPatient(record PatientRecord, diagnoses DiagnosesRecord, pseudonymizer Pseudonymizer) PatientData {
+	result := PatientData{
+		ID: pseudonymizer.Pseudonymize(record.PatientID),
+	}
+
+	// GENDER + SEX
+	if record.Geschlecht != nil {
+		if *record.Geschlecht == "m" {
+			result.Sex = "Male"
+			result.Gender = "Male"
+		} else if *record.Geschlecht == "w" {
+			result.Sex = "Female"
+			result.Gender = "Female"
+		}
+		// Others - Code?
+	}
+
+	// AGE
+	if record.Alter != nil {
+		result.Age = fmt.Sprint(*record.Alter)
+	}
+
+	// OS_STATUS
+	// OS_MONTHS applied using appendDiagnoseDaten()
+	if record.Sterbedatum != nil {
+		result.OsStatus = "DECEASED"
+	} else {
+		result.OsStatus = "LIVING"
+	}
+
+	if record.Karnofsky != nil {
+		result.MtbEcogStatus = karnofskyToEcog(*record.Karnofsky)
+	} else {
+		result.MtbEcogStatus = "NA"
+	}
+
+	appendDiagnoseDaten(&result, diagnoses)
+
+	// DFS
+	result.DfsStatus = "NA"
+	result.DfsMonths = "NA"
+
+	return result
+}
+
+// Ermittelt den ECOG anhand des Karnofsky-Grads
+func karnofskyToEcog(karnofsky string) string {
+
+	// Plain percent number
+	karnofsky = strings.ReplaceAll(karnofsky, "%", "")
+	karnofsky = strings.TrimSpace(karnofsky)
+
+	if karnofskyGrade, err := strconv.Atoi(karnofsky); err == nil {
+		if karnofskyGrade >= 90 {
+			return "0"
+		} else if karnofskyGrade >= 70 {
+			return "1"
+		} else if karnofskyGrade >= 50 {
+			return "2"
+		} else if karnofskyGrade >= 30 {
+			return "3"
+		} else if karnofskyGrade > 0 {
+			return "4"
+		} else {
+			return "5"
+		}
+	}
+
+	return "NA"
+}
+
+// Ergänzt die Patientendaten um Diagnosedaten
+func appendDiagnoseDaten(data *PatientData, diagnoses DiagnosesRecord) {
+	if diagnosis := diagnoses.Main; diagnosis != nil {
+		// OS_MONTH
+		// Aktuell nur ganze Monate als Kommazahl (Anzahl Tage / 30) - ermittelt über SQL-Query
+		if diagnosis.OsMonths != nil {
+			data.OsMonths = fmt.Sprintf("%d.0", *diagnosis.OsMonths)
+		}
+
+		// ICD-O3-Morphologie Code
+		if diagnosis.Icdo3Histologie != nil {
+			data.IcdO3MorphCode = *diagnosis.Icdo3Histologie
+		}
+
+		// ICD10 Code
+		if diagnosis.Icd10 != nil {
+			data.Icd10Code = *diagnosis.Icd10
+		}
+
+		// DIAGNOSIS
+		if diagnosis.Diagnose != nil {
+			data.Diagnosis = sanitizeUmlaute(*diagnosis.Diagnose)
+		}
+
+		// ONKOTREE_CODE
+		data.OncotreeCode = "NA"
+
+		// SPREAD_OF_DISEASE wird bisher nicht befüllt: Der Textwert von Fernmetastasen wurde mit der Zahl 1
+		// verglichen, der Vergleich trifft nie zu.
+
+		// Erstes Jahr mit MTB
+		if diagnosis.FirstMtbYear != nil {
+			data.XFirstMtbYear = *diagnosis.FirstMtbYear
+		}
+	}
+
+	var diags []string
+	for _, erkrankung := range diagnoses.All {
+		if erkrankung != data.Diagnosis {
+			diags = append(diags, erkrankung)
+		}
+	}
+
+	data.PastMalignantDisease = sanitizeUmlaute(strings.Join(diags, " + "))
+}
+
+type PatientData struct {
+	ID                       string `csv:"PATIENT_ID"`
+	Gender                   string `csv:"GENDER"`
+	Sex                      string `csv:"SEX"`
+	Age                      string `csv:"AGE"`
+	IcdO3MorphCode           string `csv:"ICD_O3_MORPH_CODE"`
+	Diagnosis                string `csv:"DIAGNOSIS"`
+	OncotreeCode             string `csv:"ONCOTREE_CODE"`
+	Icd10Code                string `csv:"ICD_10_CODE"`
+	SpreadOfDisease          string `csv:"SPREAD_OF_DISEASE"`
+	MtbEcogStatus            string `csv:"MTB_ECOG_STATUS"`
+	PastMalignantDisease     string `csv:"PAST_MALIGNANT_DISEASE"`
+	PretherapyProgress       string `csv:"PREATHERAPY_PROGRESS"`
+	NumSystemicPretherapy    string `csv:"NUM_SYSTEMIC_PRETHERAPY"`
+	PretherapyMedication     string `csv:"PREATHERAPY_MEDICATION"`
+	PretherapyMedicationNcit string `csv:"PREATHERAPY_MEDICATION_NCIT"`
+	PretherapyBestResponse   string `csv:"PREATHERAPY_BEST_RESPONSE"`
+	PretherapyPfs            string `csv:"PREATHERAPY_PFS"`
+	OsStatus                 string `csv:"OS_STATUS"`
+	OsMonths                 string `csv:"OS_MONTHS"`
+	DfsStatus                string `csv:"DFS_STATUS"`
+	DfsMonths                string `csv:"DFS_MONTHS"`
+	XFirstMtbYear            string `csv:"x_first_mtb_year"`
+}
+
+func PatientDataHeaders() []string {
+	return []string{"PATIENT_ID",
+		"GENDER",
+		"SEX",
+		"AGE",
+		"ICD_O3_MORPH_CODE",
+		"DIAGNOSIS",
+		"ONCOTREE_CODE",
+		"ICD_10_CODE",
+		"SPREAD_OF_DISEASE",
+		"MTB_ECOG_STATUS",
+		"PAST_MALIGNANT_DISEASE",
+		"PREATHERAPY_PROGRESS",
+		"NUM_SYSTEMIC_PRETHERAPY",
+		"PREATHERAPY_MEDICATION",
+		"PREATHERAPY_MEDICATION_NCIT",
+		"PREATHERAPY_BEST_RESPONSE",
+		"PREATHERAPY_PFS",
+		"OS_STATUS",
+		"OS_MONTHS",
+		"DFS_STATUS",
+		"DFS_MONTHS",
+		"x_first_mtb_year",
+	}
+}
+
+func (data *PatientData) AsStringArray() []string {
+	return []string{
+		data.ID,
+		data.Gender,
+		data.Sex,
+		data.Age,
+		data.IcdO3MorphCode,
+		data.Diagnosis,
+		data.OncotreeCode,
+		data.Icd10Code,
+		data.SpreadOfDisease,
+		data.MtbEcogStatus,
+		data.PastMalignantDisease,
+		data.PretherapyProgress,
+		data.NumSystemicPretherapy,
+		data.PretherapyMedication,
+		data.PretherapyMedicationNcit,
+		data.PretherapyBestResponse,
+		data.PretherapyPfs,
+		data.OsStatus,
+		data.OsMonths,
+		data.DfsStatus,
+		data.DfsMonths,
+		data.XFirstMtbYear,
+	}
+}
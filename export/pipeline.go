@@ -0,0 +1,67 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Verarbeitet die Patienten-IDs in Teilmengen mit der konfigurierten Anzahl paralleler Worker.
+// Ergebnisse und Fehler werden in der Reihenfolge der Teilmengen zusammengeführt, unabhängig davon,
+// in welcher Reihenfolge die Worker fertig werden. Nach Abbruch des Kontexts werden keine weiteren
+// Teilmengen verarbeitet.
+func processChunks[T any](ctx context.Context, patientIds []string, chunkSize int, workers int, process func(ctx context.Context, chunk []string) ([]T, error)) ([]T, error) {
+	chunks := slices.Collect(slices.Chunk(patientIds, chunkSize))
+	results := make([][]T, len(chunks))
+	errs := make([]error, len(chunks))
+
+	indices := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(workers, len(chunks)) {
+		wg.Go(func() {
+			for index := range indices {
+				if ctx.Err() != nil {
+					continue
+				}
+				results[index], errs[index] = process(ctx, chunks[index])
+			}
+		})
+	}
+dispatch:
+	for index := range chunks {
+		select {
+		case indices <- index:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	return slices.Concat(results...), errors.Join(append([]error{ctx.Err()}, errs...)...)
+}
+
+// Ermittelt alle Fehler zu einzelnen Patienten aus einem zusammengefassten Fehler
+func PatientErrors(err error) []*PatientError {
+	if patientErr, ok := err.(*PatientError); ok {
+		return []*PatientError{patientErr}
+	}
+	var result []*PatientError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			result = append(result, PatientErrors(e)...)
+		}
+	}
+	return result
+}
+
+// Prüft, ob ein Fehler nur aus Fehlern zu einzelnen Patienten besteht. Die Daten aller anderen Patienten
+// sind dann dennoch im Ergebnis enthalten.
+func onlyPatientErrors(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return !slices.ContainsFunc(joined.Unwrap(), func(err error) bool { return !onlyPatientErrors(err) })
+	}
+	_, ok := err.(*PatientError)
+	return ok
+}
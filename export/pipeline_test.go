@@ -0,0 +1,70 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShouldKeepOrderOfChunks(t *testing.T) {
+	var patientIds []string
+	for i := range 20 {
+		patientIds = append(patientIds, strconv.Itoa(i))
+	}
+
+	actual, err := processChunks(t.Context(), patientIds, 3, 4, func(_ context.Context, chunk []string) ([]string, error) {
+		// Spätere Teilmengen werden zuerst fertig
+		index, _ := strconv.Atoi(chunk[0])
+		time.Sleep(time.Duration(20-index) * time.Millisecond)
+		return chunk, nil
+	})
+
+	if err != nil || !slices.Equal(actual, patientIds) {
+		t.Logf("wrong order: Expected %v, got %v (%v)", patientIds, actual, err)
+		t.Fail()
+	}
+}
+
+func TestShouldCollectAllPatientErrors(t *testing.T) {
+	patientIds := []string{"1", "2", "3", "4", "5"}
+
+	actual, err := processChunks(t.Context(), patientIds, 2, 3, func(_ context.Context, chunk []string) ([]string, error) {
+		if slices.Contains(chunk, "3") {
+			return nil, chunkError(chunk, errors.New("test"))
+		}
+		return chunk, nil
+	})
+
+	if !slices.Equal(actual, []string{"1", "2", "5"}) {
+		t.Logf("wrong result: %v", actual)
+		t.Fail()
+	}
+
+	patientErrors := PatientErrors(err)
+	if len(patientErrors) != 2 || patientErrors[0].PatientID != "3" || patientErrors[1].PatientID != "4" {
+		t.Logf("wrong patient errors: %v", patientErrors)
+		t.Fail()
+	}
+}
+
+func TestShouldStopProcessingAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	patientIds := []string{"1", "2", "3", "4", "5"}
+
+	actual, err := processChunks(ctx, patientIds, 1, 1, func(_ context.Context, chunk []string) ([]string, error) {
+		cancel()
+		return chunk, nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Logf("expected context.Canceled, got %v", err)
+		t.Fail()
+	}
+	if len(actual) >= len(patientIds) {
+		t.Logf("expected processing to stop, got %v", actual)
+		t.Fail()
+	}
+}
@@ -0,0 +1,31 @@
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Pseudonymisiert Patienten- und Proben-IDs für den Export
+type Pseudonymizer interface {
+	Pseudonymize(id string) string
+}
+
+// Pseudonymisierung anhand der ersten 10 Zeichen des SHA256-Hashs einer ID mit vorangestelltem Prefix
+type HashPseudonymizer struct {
+	Prefix string
+}
+
+func (pseudonymizer HashPseudonymizer) Pseudonymize(id string) string {
+	sha := sha256.New()
+	sha.Write([]byte(id))
+	hash := hex.EncodeToString(sha.Sum(nil))
+
+	return pseudonymizer.Prefix + "_" + hash[0:10]
+}
+
+// Keine Pseudonymisierung. IDs werden unverändert übernommen.
+type NoPseudonymizer struct{}
+
+func (pseudonymizer NoPseudonymizer) Pseudonymize(id string) string {
+	return id
+}
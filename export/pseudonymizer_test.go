@@ -0,0 +1,21 @@
+package export
+
+import "testing"
+
+func TestShouldPseudonymizeWithHashAndPrefix(t *testing.T) {
+	actual := HashPseudonymizer{Prefix: "WUE"}.Pseudonymize("H1234-24")
+	expected := "WUE_e7a1d73956"
+	if actual != expected {
+		t.Logf("wrong value: Expected %s, got %s", expected, actual)
+		t.Fail()
+	}
+}
+
+func TestShouldNotPseudonymize(t *testing.T) {
+	actual := NoPseudonymizer{}.Pseudonymize("H1234-24")
+	expected := "H1234-24"
+	if actual != expected {
+		t.Logf("wrong value: Expected %s, got %s", expected, actual)
+		t.Fail()
+	}
+}
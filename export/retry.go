@@ -0,0 +1,94 @@
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Standardwartezeit vor der ersten Wiederholung einer Abfrage. Die Wartezeit verdoppelt sich mit jeder Wiederholung.
+const DefaultRetryDelay = 500 * time.Millisecond
+
+// Maximale Wartezeit zwischen zwei Wiederholungen
+const maxRetryDelay = 30 * time.Second
+
+// MySQL-Fehlercodes, bei denen eine Wiederholung der Abfrage erfolgreich sein kann
+var transientErrorNumbers = []uint16{
+	1205, // Lock wait timeout exceeded
+	1213, // Deadlock found when trying to get lock
+	2006, // MySQL server has gone away
+	2013, // Lost connection to MySQL server during query
+}
+
+// Prüft, ob es sich um einen vorübergehenden Fehler der Datenbankverbindung handelt
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && slices.Contains(transientErrorNumbers, mysqlErr.Number)
+}
+
+// Patienten, deren Abfragen wiederholt wurden
+type retryLog struct {
+	mutex      sync.Mutex
+	patientIds map[string]bool
+}
+
+func (retried *retryLog) add(patientIds []string) {
+	retried.mutex.Lock()
+	defer retried.mutex.Unlock()
+	if retried.patientIds == nil {
+		retried.patientIds = map[string]bool{}
+	}
+	for _, patientID := range patientIds {
+		retried.patientIds[patientID] = true
+	}
+}
+
+func (retried *retryLog) patients() []string {
+	retried.mutex.Lock()
+	defer retried.mutex.Unlock()
+	return slices.Sorted(maps.Keys(retried.patientIds))
+}
+
+// Führt die Abfrage aus und wiederholt sie bei vorübergehenden Fehlern mit exponentiell steigender Wartezeit.
+// Wiederholungen werden für die angegebenen Patienten protokolliert.
+func retry[T any](ctx context.Context, exporter *Exporter, patientIds []string, query func() (T, error)) (T, error) {
+	delay := exporter.config.RetryDelay
+	for attempt := 0; ; attempt++ {
+		result, err := query()
+		if err == nil || !isTransient(err) {
+			return result, err
+		}
+		if attempt >= exporter.config.Retries {
+			if attempt > 0 {
+				err = fmt.Errorf("%w (nach %d Wiederholungen)", err, attempt)
+			}
+			return result, err
+		}
+
+		exporter.retried.add(patientIds)
+		select {
+		case <-ctx.Done():
+			return result, errors.Join(ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
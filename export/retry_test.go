@@ -0,0 +1,94 @@
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Datenquelle, bei der die ersten Abfragen von Untersuchungen fehlschlagen
+type failingSource struct {
+	*MemorySource
+	failures int
+	err      error
+	calls    int
+}
+
+func (source *failingSource) MolecularProcedures(ctx context.Context, patientIds []string, selection Selection) (map[string][]MolecularRecord, error) {
+	source.calls++
+	if source.calls <= source.failures {
+		return nil, source.err
+	}
+	return source.MemorySource.MolecularProcedures(ctx, patientIds, selection)
+}
+
+func TestShouldDetectTransientErrors(t *testing.T) {
+	for err, expected := range map[error]bool{
+		driver.ErrBadConn: true,
+		fmt.Errorf("query: %w", mysql.ErrInvalidConn): true,
+		&mysql.MySQLError{Number: 1205}:               true,
+		&mysql.MySQLError{Number: 1146}:               false,
+		errors.New("test"):                            false,
+		context.Canceled:                              false,
+	} {
+		if isTransient(err) != expected {
+			t.Logf("wrong result for '%v': Expected %v", err, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldRetryTransientErrors(t *testing.T) {
+	source := &failingSource{MemorySource: testSource(), failures: 2, err: driver.ErrBadConn}
+	exporter := NewExporterWithSource(Config{Retries: 3, RetryDelay: time.Millisecond}, source, nil)
+
+	actual, err := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+
+	if err != nil || len(actual) != 2 {
+		t.Logf("unexpected result: %v, %v", actual, err)
+		t.Fail()
+	}
+	if source.calls != 3 {
+		t.Logf("wrong number of calls: Expected 3, got %d", source.calls)
+		t.Fail()
+	}
+	if !slices.Equal(exporter.RetriedPatients(), []string{"2000123"}) {
+		t.Logf("wrong retried patients: %v", exporter.RetriedPatients())
+		t.Fail()
+	}
+}
+
+func TestShouldFailAfterRetries(t *testing.T) {
+	source := &failingSource{MemorySource: testSource(), failures: 5, err: driver.ErrBadConn}
+	exporter := NewExporterWithSource(Config{Retries: 2, RetryDelay: time.Millisecond}, source, nil)
+
+	_, err := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+
+	patientErrors := PatientErrors(err)
+	if len(patientErrors) != 1 || !errors.Is(err, driver.ErrBadConn) {
+		t.Logf("expected patient error, got %v", err)
+		t.Fail()
+	}
+	if source.calls != 3 {
+		t.Logf("wrong number of calls: Expected 3, got %d", source.calls)
+		t.Fail()
+	}
+}
+
+func TestShouldNotRetryOtherErrors(t *testing.T) {
+	source := &failingSource{MemorySource: testSource(), failures: 1, err: errors.New("test")}
+	exporter := NewExporterWithSource(Config{Retries: 3, RetryDelay: time.Millisecond}, source, nil)
+
+	_, err := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+
+	if err == nil || source.calls != 1 || len(exporter.RetriedPatients()) != 0 {
+		t.Logf("unexpected retry: %d calls, %v", source.calls, err)
+		t.Fail()
+	}
+}
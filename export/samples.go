@@ -0,0 +1,343 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type SampleFilter = int
+
+const (
+	None SampleFilter = iota
+	OcaPlusOnly
+	WesOnly
+	WgsOnly
+)
+
+// Prüft, ob eine molekulargenetische Untersuchung dem Filter entspricht
+func matchesFilter(record MolecularRecord, filter SampleFilter) bool {
+	switch filter {
+	case OcaPlusOnly:
+		return record.PanelCode != nil && *record.PanelCode == "OCAPlus"
+	case WesOnly:
+		return record.Artdersequenzierung != nil && *record.Artdersequenzierung == "WES"
+	case WgsOnly:
+		return record.Artdersequenzierung != nil && *record.Artdersequenzierung == "WGS"
+	}
+	return true
+}
+
+// Bildet eine molekulargenetische Untersuchung mit Biomarkern auf Probendaten ab
+func mapSample(patientID string, record MolecularRecord, biomarker BiomarkerRecord, pseudonymizer Pseudonymizer) SampleData {
+	data := SampleData{}
+
+	// SAMPLE_ID
+	data.PatientID = pseudonymizer.Pseudonymize(patientID)
+	data.SampleID = pseudonymizer.Pseudonymize(SanitizeSampleId(*record.Einsendenummer))
+
+	data.SampleLocRefPrimarus = "NA"
+
+	// SAMPLE_LOC_REF_PRIMARIUS
+	if value := record.Probenmaterial; value != nil {
+		if *value == "T" {
+			data.SampleLocRefPrimarus = "Primaertumor"
+		} else if *value == "M" {
+			data.SampleLocRefPrimarus = "Metastase"
+		}
+	}
+
+	// SAMPLE_METHOD - nur bekannt "Biopsie" und "Resektat". Andere mögliche Werte?
+	if value := record.Entnahmemethode; value != nil {
+		if *value == "B" {
+			data.SampleMethod = "Biopsie"
+		} else if *value == "R" {
+			data.SampleMethod = "Resektat"
+		}
+	}
+
+	// SAMPLE_LOCATION
+	if value := record.SampleLocation; value != nil {
+		data.SampleLocation = *value
+	} else {
+		data.SampleLocation = "NA"
+	}
+
+	// SAMPLE_AGE
+	if record.Datum != nil && record.Entnahmedatum != nil {
+		if datum, err := time.Parse("2006-01-02", *record.Datum); err == nil {
+			if entnahmedatum, err := time.Parse("2006-01-02", *record.Entnahmedatum); err == nil {
+				data.SampleAge = fmt.Sprintf("%f", datum.Sub(entnahmedatum).Hours()/24)
+			}
+		}
+	}
+
+	// TUMOR_CELL_AMOUNT
+	if value := record.Tumorzellgehalt; value != nil {
+		data.TumorCellAmount = *value
+	} else {
+		data.TumorCellAmount = "NA"
+	}
+
+	// SEQUENCING_DNA_PANEL / FUSION_RNA_PANEL
+	// Initial values - wenn nicht anders angegeben
+	data.SequencingDnaPanel = "NA"
+	data.FusionRnaPanel = "NA"
+	if value, panel := record.Nukleinsaeure, record.Panel; value != nil && panel != nil {
+		if *value == "dna" {
+			data.SequencingDnaPanel = *panel
+		} else if *value == "rna" {
+			data.FusionRnaPanel = *panel
+		} else if *value == "dnarna" {
+			data.SequencingDnaPanel = *panel
+			data.FusionRnaPanel = *panel
+		}
+	}
+
+	// SEQUENCING_DNA_PLATFORM + SEQUENCING_RNA_PLATFORM
+	// Initial values - wenn nicht anders angegeben
+	data.SequencingDnaPlatform = "NA"
+	data.SequencingRnaPlatform = "NA"
+	if value, panelCode := record.Nukleinsaeure, record.PanelCode; value != nil && panelCode != nil {
+		// Keine Onkostar-Dokumentation in Wuerzburg
+		// Implementierung fuer WUE_
+		if strings.HasPrefix(data.SampleID, "WUE_") {
+			// DNA
+			if (*value == "dna" || *value == "dnarna") && (*panelCode == "OCAPlus" || *panelCode == "OncomineV3" || *panelCode == "OFA") {
+				data.SequencingDnaPlatform = "Thermo Fisher"
+			}
+			// RNA
+			if (*value == "rna" || *value == "dnarna") && (*panelCode == "OCAPlus" || *panelCode == "AFPLung" || *panelCode == "AFPSarc") {
+				data.SequencingRnaPlatform = "Thermo Fisher"
+			}
+		}
+	}
+
+	// TMB_SCORE aus alten Formular "OS.Molekulargenetik" vor rev 81
+	if value := record.Tumormutationalburden; value != nil {
+		data.TmbScore = *value
+	} else {
+		data.TmbScore = "NA"
+	}
+
+	appendImmunhisto(&data, biomarker.Immunhisto)
+
+	// MSI_PANEL
+	data.MsiPanel = "NA"
+	data.MsiPcr = "NA"
+	data.MsiIg = "NA"
+	for _, value := range biomarker.Msi {
+		data.MsiPanel = value
+	}
+
+	// TMB_SCORE aus neuem Formular "OS.Molekulargenetik" ab rev 81
+	for _, value := range biomarker.Tmb {
+		data.TmbScore = value
+	}
+
+	// GIM_/HRD_SCORE
+	data.GimScore = "NA"
+	data.HrdScore = "NA"
+	hrd := hrdValues(biomarker.Hrd)
+	if record.PanelCode != nil && *record.PanelCode == "OCAPlus" {
+		data.GimScore = hrd.score
+	} else {
+		data.HrdScore = hrd.score
+	}
+	// HRD-LOH, TAI, LST
+	data.Tai = hrd.tai
+	data.HrdLoh = hrd.loh
+	data.Lst = hrd.lst
+
+	data.Her2Fish = "NA"
+	data.OtherExamination = "NA"
+	data.OtherIhc = "NA"
+	data.DakoScore = "NA"
+	data.Fusions = "NA"
+	data.SpliceVariants = "NA"
+	data.Mutations = "NA"
+	data.Cnv = "NA"
+
+	return data
+}
+
+// Schreibt die Werte TPS, ICS und CPS in bestehende Probendaten
+func appendImmunhisto(sampleData *SampleData, immunhisto *ImmunhistoRecord) {
+	// Initial values
+	sampleData.Tps = "NA"
+	sampleData.Ics = "NA"
+	sampleData.Cps = "NA"
+
+	if immunhisto == nil || immunhisto.Gen == nil || *immunhisto.Gen != "PDL1" {
+		return
+	}
+
+	// TPS
+	if value := immunhisto.Tps; value != nil {
+		sampleData.Tps = *value
+	}
+	// ICS
+	if value := immunhisto.IcScore; value != nil {
+		sampleData.Ics = *value
+	}
+	// CPS
+	if value := immunhisto.Cps; value != nil {
+		sampleData.Cps = *value
+	}
+}
+
+type Hrd struct {
+	score string
+	lst   string
+	tai   string
+	loh   string
+}
+
+// Ermittelt die HRD-Werte. Bei mehreren Einträgen wird jeweils der letzte vorhandene Wert verwendet.
+func hrdValues(records []HrdRecord) Hrd {
+	result := Hrd{
+		score: "NA",
+		lst:   "NA",
+		tai:   "NA",
+		loh:   "NA",
+	}
+
+	for _, record := range records {
+		if record.Score != nil {
+			result.score = *record.Score
+		}
+		if record.Lst != nil {
+			result.lst = *record.Lst
+		}
+		if record.Tai != nil {
+			result.tai = *record.Tai
+		}
+		if record.Loh != nil {
+			result.loh = *record.Loh
+		}
+	}
+
+	return result
+}
+
+// Wandelt Proben-IDs der Form A/2024/1234 in das Format A1234-24
+func SanitizeSampleId(id string) string {
+	re := regexp.MustCompile("(?P<Letter>[A-Z])/\\d{2}(?P<Year2>\\d{2})/(?P<LfdNr>\\d+)")
+	if re.MatchString(id) {
+		matches := re.FindStringSubmatch(id)
+		return fmt.Sprintf(
+			"%s%s-%s",
+			matches[re.SubexpIndex("Letter")],
+			matches[re.SubexpIndex("LfdNr")],
+			matches[re.SubexpIndex("Year2")],
+		)
+	}
+	return id
+}
+
+type SampleData struct {
+	PatientID             string `csv:"PATIENT_ID"`
+	SampleID              string `csv:"SAMPLE_ID"`
+	SampleLocRefPrimarus  string `csv:"SAMPLE_LOC_REF_PRIMARUS"`
+	SampleMethod          string `csv:"SAMPLE_METHOD"`
+	SampleLocation        string `csv:"SAMPLE_LOCATION"`
+	SampleAge             string `csv:"SAMPLE_AGE"`
+	TumorCellAmount       string `csv:"TUMOR_CELL_AMOUNT"`
+	SequencingDnaPanel    string `csv:"SEQUENCING_DNA_PANEL"`
+	SequencingDnaPlatform string `csv:"SEQUENCING_DNA_PLATFORM"`
+	FusionRnaPanel        string `csv:"FUSION_RNA_PANEL"`
+	SequencingRnaPlatform string `csv:"SEQUENCING_RNA_PLATFORM"`
+	TmbScore              string `csv:"TMB_SCORE"`
+	Tps                   string `csv:"TPS"`
+	Ics                   string `csv:"ICS"`
+	Cps                   string `csv:"CPS"`
+	MsiIg                 string `csv:"MSI_IG"`
+	MsiPcr                string `csv:"MSI_PCR"`
+	MsiPanel              string `csv:"MSI_PANEL"`
+	Her2Fish              string `csv:"HER2_FISH"`
+	OtherExamination      string `csv:"OTHER_EXAMINATION"`
+	OtherIhc              string `csv:"OTHER_IHC"`
+	DakoScore             string `csv:"DAKO_SCORE"`
+	Fusions               string `csv:"FUSIONS"`
+	SpliceVariants        string `csv:"SPLICE_VARIANTS"`
+	Mutations             string `csv:"MUTATIONS"`
+	Cnv                   string `csv:"CNV"`
+	GimScore              string `csv:"GIM_SCORE"`
+	HrdScore              string `csv:"HRD_SCORE"`
+	Lst                   string `csv:"LST"`
+	Tai                   string `csv:"TAI"`
+	HrdLoh                string `csv:"HRD_LOH"`
+}
+
+func SampleDataHeaders() []string {
+	return []string{
+		"PATIENT_ID",
+		"SAMPLE_ID",
+		"SAMPLE_LOC_REF_PRIMARUS",
+		"SAMPLE_METHOD",
+		"SAMPLE_LOCATION",
+		"SAMPLE_AGE",
+		"TUMOR_CELL_AMOUNT",
+		"SEQUENCING_DNA_PANEL",
+		"SEQUENCING_DNA_PLATFORM",
+		"FUSION_RNA_PANEL",
+		"SEQUENCING_RNA_PLATFORM",
+		"TMB_SCORE",
+		"TPS",
+		"ICS",
+		"CPS",
+		"MSI_IG",
+		"MSI_PCR",
+		"MSI_PANEL",
+		"HER2_FISH",
+		"OTHER_EXAMINATION",
+		"OTHER_IHC",
+		"DAKO_SCORE",
+		"FUSIONS",
+		"SPLICE_VARIANTS",
+		"MUTATIONS",
+		"CNV",
+		"GIM_SCORE",
+		"HRD_SCORE",
+		"LST",
+		"TAI",
+		"HRD_LOH",
+	}
+}
+
+func (data *SampleData) AsStringArray() []string {
+	return []string{
+		data.PatientID,
+		data.SampleID,
+		data.SampleLocRefPrimarus,
+		data.SampleMethod,
+		data.SampleLocation,
+		data.SampleAge,
+		data.TumorCellAmount,
+		data.SequencingDnaPanel,
+		data.SequencingDnaPlatform,
+		data.FusionRnaPanel,
+		data.SequencingRnaPlatform,
+		data.TmbScore,
+		data.Tps,
+		data.Ics,
+		data.Cps,
+		data.MsiIg,
+		data.MsiPcr,
+		data.MsiPanel,
+		data.Her2Fish,
+		data.OtherExamination,
+		data.OtherIhc,
+		data.DakoScore,
+		data.Fusions,
+		data.SpliceVariants,
+		data.Mutations,
+		data.Cnv,
+		data.GimScore,
+		data.HrdScore,
+		data.Lst,
+		data.Tai,
+		data.HrdLoh,
+	}
+}
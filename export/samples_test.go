@@ -1,9 +1,9 @@
-package main
+package export
 
 import "testing"
 
 func TestSanitizeSampleId(t *testing.T) {
-	actual := sanitizeSampleId("H/2024/1234")
+	actual := SanitizeSampleId("H/2024/1234")
 	expected := "H1234-24"
 	if actual != expected {
 		t.Logf("wrong value: Expected %s, got %s", expected, actual)
@@ -12,7 +12,7 @@ func TestSanitizeSampleId(t *testing.T) {
 }
 
 func TestKeepOtherFormatSampleId(t *testing.T) {
-	actual := sanitizeSampleId("H-2024-1234")
+	actual := SanitizeSampleId("H-2024-1234")
 	expected := "H-2024-1234"
 	if actual != expected {
 		t.Logf("wrong value: Expected %s, got %s", expected, actual)
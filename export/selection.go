@@ -0,0 +1,60 @@
+package export
+
+import "time"
+
+// Datum, auf das sich der Zeitraum einer Auswahl bezieht
+type DateField = int
+
+const (
+	// Datum der molekulargenetischen Untersuchung (dk_molekulargenetik.datum)
+	SequencingDate DateField = iota
+	// Datum eines MTBs der Erkrankung, der die Untersuchung zugeordnet ist
+	MtbDate
+	// Diagnosedatum einer Diagnose der Erkrankung, der die Untersuchung zugeordnet ist
+	DiagnosisDate
+)
+
+// Zeitraum zur Auswahl von Patienten und Proben. Beginn und Ende sind jeweils eingeschlossen, ohne Angabe unbegrenzt.
+type DateRange struct {
+	Field DateField
+	From  time.Time
+	To    time.Time
+}
+
+// Prüft, ob der Zeitraum unbegrenzt ist
+func (dateRange DateRange) IsZero() bool {
+	return dateRange.From.IsZero() && dateRange.To.IsZero()
+}
+
+// Prüft, ob das Datum (YYYY-MM-DD, ggf. mit Uhrzeit) im Zeitraum liegt. Ohne Datum nur bei unbegrenztem Zeitraum.
+func (dateRange DateRange) contains(date *string) bool {
+	if dateRange.IsZero() {
+		return true
+	}
+	if date == nil || len(*date) < len(time.DateOnly) {
+		return false
+	}
+	day := (*date)[:len(time.DateOnly)]
+	if !dateRange.From.IsZero() && day < dateRange.From.Format(time.DateOnly) {
+		return false
+	}
+	if !dateRange.To.IsZero() && day > dateRange.To.Format(time.DateOnly) {
+		return false
+	}
+	return true
+}
+
+// Auswahl von Patienten und Proben
+type Selection struct {
+	// Auswahl anhand Panel oder Art der Sequenzierung
+	Filter SampleFilter
+	// MTB-Typen der Tumorkonferenz, verwendet bei Zeitraum mit MtbDate
+	MtbTypes []string
+	// Zeitraum, in dem Untersuchung, MTB oder Diagnose liegen müssen
+	DateRange DateRange
+	// Anfänge von ICD-10-Codes, z.B. 'C34'. Die Erkrankung muss eine Diagnose mit einem dieser Codes haben.
+	Icd10 []string
+	// Anfänge von ICD-O-3-Morphologiecodes, z.B. '8140/3'. Die Erkrankung muss eine Diagnose mit einem dieser
+	// Codes haben, bei Angabe von Icd10 dieselbe Diagnose.
+	Morphology []string
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShouldCheckDateRange(t *testing.T) {
+	dateRange := DateRange{From: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)}
+
+	testsArgs := []struct {
+		date     *string
+		expected bool
+	}{
+		{value("2023-01-01"), true},
+		{value("2023-12-31 10:00:00"), true},
+		{value("2022-12-31"), false},
+		{value("2024-01-01"), false},
+		{nil, false},
+	}
+
+	for _, tt := range testsArgs {
+		if actual := dateRange.contains(tt.date); actual != tt.expected {
+			t.Logf("wrong result for %v: Expected %v, got %v", tt.date, tt.expected, actual)
+			t.Fail()
+		}
+	}
+
+	if !(DateRange{}).contains(nil) {
+		t.Log("expected unlimited date range to contain missing date")
+		t.Fail()
+	}
+}
+
+func TestShouldSelectSamplesBySequencingDate(t *testing.T) {
+	source := testSource()
+	source.Data[0].Procedures[0].Datum = value("2023-05-10")
+	source.Data[0].Procedures[1].Datum = value("2024-02-01")
+
+	dateRange := DateRange{Field: SequencingDate, From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	exporter := NewExporterWithSource(Config{DateRange: dateRange}, source, nil)
+
+	actual, err := exporter.FetchSampleData(t.Context(), []string{"2000123"})
+	if err != nil || len(actual) != 1 || actual[0].SampleID != "H2345-24" {
+		t.Logf("wrong samples: %v (%v)", actual, err)
+		t.Fail()
+	}
+
+	exporter = NewExporterWithSource(Config{Filter: OcaPlusOnly, DateRange: dateRange}, source, nil)
+	if patientIds, _ := exporter.FetchPatientIds(t.Context()); len(patientIds) != 0 {
+		t.Logf("wrong patient ids: %v", patientIds)
+		t.Fail()
+	}
+}
+
+func TestShouldEscapeLikePrefix(t *testing.T) {
+	testsArgs := []struct {
+		prefix   string
+		expected string
+	}{
+		{"C34", "C34%"},
+		{"8140/3", "8140/3%"},
+		{"C34_1%", "C34\\_1\\%%"},
+		{"C\\34", "C\\\\34%"},
+	}
+
+	for _, tt := range testsArgs {
+		if actual := likePrefix(tt.prefix); actual != tt.expected {
+			t.Logf("wrong pattern for %s: Expected %s, got %s", tt.prefix, tt.expected, actual)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package export
+
+import (
+	"context"
+	"errors"
+)
+
+// Fehler zu einer Patienten-ID, die in mehreren der ausgewählten Personenstämme vorkommt und daher keinem
+// Patienten eindeutig zugeordnet werden kann
+var ErrAmbiguousPatientID = errors.New("Patienten-ID in mehreren Personenstämmen vorhanden")
+
+// Datenquelle für Onkostar-Daten. Die Abbildung auf Patienten- und Probendaten erfolgt unabhängig von der
+// Datenquelle im Exporter.
+// Nicht eindeutige Patienten-IDs fehlen in den Ergebnissen von Patients, Diagnoses und MolecularProcedures.
+// Patients und MolecularProcedures geben für diese zusätzlich zum Ergebnis je einen PatientError mit
+// ErrAmbiguousPatientID zurück.
+type OnkostarSource interface {
+	// Ermittelt die IDs aller Patienten mit Molekulargenetik entsprechend der Auswahl
+	PatientIds(ctx context.Context, selection Selection) ([]string, error)
+	// Ermittelt die Stammdaten der angegebenen Patienten, sortiert nach Patienten-ID. ECOG bzw. Karnofsky-Index
+	// stammen aus Tumorkonferenzen der angegebenen MTB-Typen.
+	Patients(ctx context.Context, patientIds []string, mtbTypes []string) ([]PatientRecord, error)
+	// Ermittelt die Hauptdiagnose und alle weiteren Diagnosen der angegebenen Patienten nach Patienten-ID.
+	// Hauptdiagnosen sind nur Diagnosen von Erkrankungen mit MTB der angegebenen Typen, außer bei allTk.
+	Diagnoses(ctx context.Context, patientIds []string, mtbTypes []string, allTk bool) (map[string]DiagnosesRecord, error)
+	// Ermittelt die nicht gelöschten molekulargenetischen Untersuchungen der angegebenen Patienten nach Patienten-ID.
+	// Untersuchungen sind nach Erkrankung (zuletzt begonnene zuerst) und absteigend nach Beginn sortiert.
+	// Existierende Patienten ohne Untersuchungen sind mit leerer Liste enthalten, nicht existierende fehlen.
+	// Untersuchungen außerhalb des Zeitraums oder von Erkrankungen ohne passende Diagnose fehlen, der Filter nach Panel bzw. Art der Sequenzierung
+	// wird im Exporter angewendet.
+	MolecularProcedures(ctx context.Context, patientIds []string, selection Selection) (map[string][]MolecularRecord, error)
+	// Ermittelt die Biomarker (Unterformulare) der angegebenen molekulargenetischen Untersuchungen nach Prozedur-ID
+	Biomarkers(ctx context.Context, prozedurIds []string) (map[string]BiomarkerRecord, error)
+}
+
+// Stammdaten eines Patienten. Nicht vorhandene Werte sind nil.
+type PatientRecord struct {
+	PatientID   string  `json:"patient_id"`
+	Geschlecht  *string `json:"geschlecht"`
+	Alter       *int    `json:"alter"`
+	Sterbedatum *string `json:"sterbedatum"`
+	Karnofsky   *string `json:"karnofsky"`
+}
+
+// Daten einer Diagnose
+type DiagnosisRecord struct {
+	Icdo3Histologie *string `json:"icdo3histologie"`
+	Beginndatum     *string `json:"beginndatum"`
+	Icd10           *string `json:"icd10"`
+	Fernmetastasen  *string `json:"fernmetastasen"`
+	Diagnose        *string `json:"diagnose"`
+	OsMonths        *int    `json:"os_months"`
+	FirstMtbYear    *string `json:"first_mtb_year"`
+}
+
+// Hauptdiagnose und Bezeichnungen aller Diagnosen eines Patienten
+type DiagnosesRecord struct {
+	Main *DiagnosisRecord `json:"main"`
+	All  []string         `json:"all"`
+}
+
+// Daten einer molekulargenetischen Untersuchung
+type MolecularRecord struct {
+	ProzedurID            string  `json:"prozedur_id"`
+	Datum                 *string `json:"datum"`
+	Einsendenummer        *string `json:"einsendenummer"`
+	Probenmaterial        *string `json:"probenmaterial"`
+	Entnahmemethode       *string `json:"entnahmemethode"`
+	Entnahmedatum         *string `json:"entnahmedatum"`
+	Tumorzellgehalt       *string `json:"tumorzellgehalt"`
+	Tumormutationalburden *string `json:"tumormutationalburden"`
+	SampleLocation        *string `json:"sample_location"`
+	Nukleinsaeure         *string `json:"nukleinsaeure"`
+	PanelCode             *string `json:"panel_code"`
+	Panel                 *string `json:"panel"`
+	Artdersequenzierung   *string `json:"artdersequenzierung"`
+}
+
+// Immunhistochemie einer molekulargenetischen Untersuchung
+type ImmunhistoRecord struct {
+	Gen     *string `json:"gen"`
+	Tps     *string `json:"tps"`
+	IcScore *string `json:"ic_score"`
+	Cps     *string `json:"cps"`
+}
+
+// HRD-Werte einer molekulargenetischen Untersuchung
+type HrdRecord struct {
+	Score *string `json:"score"`
+	Lst   *string `json:"lst"`
+	Tai   *string `json:"tai"`
+	Loh   *string `json:"loh"`
+}
+
+// Biomarker einer molekulargenetischen Untersuchung
+type BiomarkerRecord struct {
+	Immunhisto *ImmunhistoRecord `json:"immunhisto"`
+	Msi        []string          `json:"msi"`
+	Hrd        []HrdRecord       `json:"hrd"`
+	Tmb        []string          `json:"tmb"`
+}
@@ -0,0 +1,780 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Datenbankverbindung oder Transaktion
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Datenquelle mit Zugriff auf eine Onkostar-Datenbank (MySQL/MariaDB)
+type SQLSource struct {
+	db           queryer
+	queryTimeout time.Duration
+	persStamm    []int
+	chunkSize    int
+}
+
+// Erstellt eine Datenquelle für die Datenbank. Ist queryTimeout größer 0, wird jede Abfrage nach dieser Dauer abgebrochen.
+func NewSQLSource(db *sql.DB, queryTimeout time.Duration) *SQLSource {
+	return &SQLSource{
+		db:           db,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// Erstellt eine Datenquelle, die alle Abfragen in der angegebenen Transaktion ausführt.
+// Abfragen einer Transaktion dürfen nicht parallel erfolgen.
+func NewSQLSourceTx(tx *sql.Tx, queryTimeout time.Duration) *SQLSource {
+	return &SQLSource{
+		db:           tx,
+		queryTimeout: queryTimeout,
+	}
+}
+
+// Beschränkt alle Abfragen auf Patienten der angegebenen Personenstämme. Ohne Angabe werden Patienten aller
+// Personenstämme berücksichtigt.
+func (source *SQLSource) WithPersStamm(persStamm []int) *SQLSource {
+	source.persStamm = persStamm
+	return source
+}
+
+// Legt die Anzahl der Prozedur-IDs fest, die gemeinsam abgefragt werden. Standard ist DefaultChunkSize.
+func (source *SQLSource) WithChunkSize(chunkSize int) *SQLSource {
+	source.chunkSize = chunkSize
+	return source
+}
+
+// Startet eine lesende Transaktion mit REPEATABLE READ. Alle Abfragen in dieser Transaktion sehen denselben
+// Datenstand, auch wenn währenddessen Daten in Onkostar geändert werden.
+func BeginConsistentRead(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	return db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// Ergebnis einer Abfrage. Mit Close() wird auch der Kontext der Abfrage freigegeben.
+type queryRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (rows *queryRows) Close() error {
+	defer rows.cancel()
+	return rows.Rows.Close()
+}
+
+func closeRows(rows *queryRows) {
+	_ = rows.Close()
+}
+
+// Führt eine Abfrage mit dem Kontext und ggf. maximaler Dauer je Abfrage aus
+func (source *SQLSource) query(ctx context.Context, query string, args ...any) (*queryRows, error) {
+	cancel := context.CancelFunc(func() {})
+	if source.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, source.queryTimeout)
+	}
+	rows, err := source.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &queryRows{Rows: rows, cancel: cancel}, nil
+}
+
+// Bedingung für die Personenstämme der Patienten in der angegebenen Tabelle, leer ohne Einschränkung
+func (source *SQLSource) persStammCondition(table string) string {
+	if len(source.persStamm) == 0 {
+		return ""
+	}
+	return " AND " + table + ".personenstamm_id IN (" + placeholders(len(source.persStamm)) + ")"
+}
+
+// Parameter zur Bedingung für die Personenstämme
+func (source *SQLSource) persStammArgs() []any {
+	result := make([]any, len(source.persStamm))
+	for i, persStamm := range source.persStamm {
+		result[i] = persStamm
+	}
+	return result
+}
+
+// Teilt die Patienten-IDs in eindeutige und solche, die in mehreren der Personenstämme vorkommen. Für letztere
+// wird je ein PatientError mit ErrAmbiguousPatientID zurückgegeben. Bei genau einem Personenstamm ist jede
+// Patienten-ID eindeutig.
+func (source *SQLSource) uniquePatientIds(ctx context.Context, patientIds []string) ([]string, error, error) {
+	if len(source.persStamm) == 1 || len(patientIds) == 0 {
+		return patientIds, nil, nil
+	}
+
+	query := `SELECT patienten_id FROM patient WHERE patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("patient") + `
+		GROUP BY patienten_id HAVING COUNT(*) > 1`
+
+	rows, err := source.query(ctx, query, append(queryArgs(patientIds), source.persStammArgs()...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeRows(rows)
+
+	ambiguous := map[string]bool{}
+	var patientID string
+	for rows.Next() {
+		if err := rows.Scan(&patientID); err == nil {
+			ambiguous[patientID] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var unique []string
+	var errs []error
+	for _, patientID := range patientIds {
+		if ambiguous[patientID] {
+			errs = append(errs, &PatientError{PatientID: patientID, Err: ErrAmbiguousPatientID})
+			continue
+		}
+		unique = append(unique, patientID)
+	}
+	return unique, errors.Join(errs...), nil
+}
+
+func nullString(value sql.NullString) *string {
+	if value.Valid {
+		return &value.String
+	}
+	return nil
+}
+
+// Bedingung für den Zeitraum der Auswahl an der molekulargenetischen Untersuchung. Bei MTB- und Diagnosedatum muss
+// die Erkrankung, der die Untersuchung zugeordnet ist, ein MTB bzw. eine Diagnose im Zeitraum haben.
+func dateRangeCondition(selection Selection, prozedurTable string, molekulargenetikTable string) (string, []any) {
+	dateRange := selection.DateRange
+	if dateRange.IsZero() {
+		return "", nil
+	}
+
+	var args []any
+	rangeCondition := func(column string) string {
+		condition := ""
+		if !dateRange.From.IsZero() {
+			condition += " AND " + column + " >= ?"
+			args = append(args, dateRange.From.Format(time.DateOnly))
+		}
+		// Vor dem Folgetag, damit auch Werte mit Uhrzeit am letzten Tag enthalten sind
+		if !dateRange.To.IsZero() {
+			condition += " AND " + column + " < ?"
+			args = append(args, dateRange.To.AddDate(0, 0, 1).Format(time.DateOnly))
+		}
+		return condition
+	}
+
+	switch dateRange.Field {
+	case MtbDate:
+		mtbTypes := selection.MtbTypes
+		if len(mtbTypes) == 0 {
+			mtbTypes = []string{DefaultMtbType}
+		}
+		args = queryArgs(mtbTypes)
+		condition := rangeCondition("p_zeitraum.beginndatum")
+		return ` AND ` + prozedurTable + `.id IN (
+			SELECT ep_untersuchung.prozedur_id FROM erkrankung_prozedur ep_untersuchung
+				JOIN erkrankung_prozedur ep_zeitraum ON (ep_zeitraum.erkrankung_id = ep_untersuchung.erkrankung_id)
+				JOIN prozedur p_zeitraum ON (p_zeitraum.id = ep_zeitraum.prozedur_id)
+				JOIN dk_tumorkonferenz dt_zeitraum ON (dt_zeitraum.id = p_zeitraum.id AND dt_zeitraum.tk IN (` + placeholders(len(mtbTypes)) + `))
+				WHERE p_zeitraum.geloescht = 0` + condition + `)`, args
+	case DiagnosisDate:
+		condition := rangeCondition("dd_zeitraum.diagnosedatum")
+		return ` AND ` + prozedurTable + `.id IN (
+			SELECT ep_untersuchung.prozedur_id FROM erkrankung_prozedur ep_untersuchung
+				JOIN erkrankung_prozedur ep_zeitraum ON (ep_zeitraum.erkrankung_id = ep_untersuchung.erkrankung_id)
+				JOIN prozedur p_zeitraum ON (p_zeitraum.id = ep_zeitraum.prozedur_id)
+				JOIN dk_diagnose dd_zeitraum ON (dd_zeitraum.id = p_zeitraum.id)
+				WHERE p_zeitraum.geloescht = 0` + condition + `)`, args
+	}
+	condition := rangeCondition(molekulargenetikTable + ".datum")
+	return condition, args
+}
+
+// Bedingung für die Diagnosen der Auswahl an der molekulargenetischen Untersuchung. Die Erkrankung, der die
+// Untersuchung zugeordnet ist, muss eine Diagnose mit passendem ICD-10- und ICD-O-3-Morphologiecode haben.
+func diagnosisCondition(selection Selection, prozedurTable string) (string, []any) {
+	if len(selection.Icd10) == 0 && len(selection.Morphology) == 0 {
+		return "", nil
+	}
+
+	var args []any
+	prefixCondition := func(column string, prefixes []string) string {
+		if len(prefixes) == 0 {
+			return ""
+		}
+		var conditions []string
+		for _, prefix := range prefixes {
+			conditions = append(conditions, column+" LIKE ?")
+			args = append(args, likePrefix(prefix))
+		}
+		return " AND (" + strings.Join(conditions, " OR ") + ")"
+	}
+
+	condition := prefixCondition("dd_auswahl.icd10", selection.Icd10)
+	condition += prefixCondition("dd_auswahl.icdo3histologie", selection.Morphology)
+	return ` AND ` + prozedurTable + `.id IN (
+			SELECT ep_untersuchung.prozedur_id FROM erkrankung_prozedur ep_untersuchung
+				JOIN erkrankung_prozedur ep_auswahl ON (ep_auswahl.erkrankung_id = ep_untersuchung.erkrankung_id)
+				JOIN prozedur p_auswahl ON (p_auswahl.id = ep_auswahl.prozedur_id)
+				JOIN dk_diagnose dd_auswahl ON (dd_auswahl.id = p_auswahl.id)
+				WHERE p_auswahl.geloescht = 0` + condition + `)`, args
+}
+
+// Bedingungen für Zeitraum und Diagnosen der Auswahl an der molekulargenetischen Untersuchung
+func selectionCondition(selection Selection, prozedurTable string, molekulargenetikTable string) (string, []any) {
+	dateCondition, dateArgs := dateRangeCondition(selection, prozedurTable, molekulargenetikTable)
+	diagnosisCondition, diagnosisArgs := diagnosisCondition(selection, prozedurTable)
+	return dateCondition + diagnosisCondition, append(dateArgs, diagnosisArgs...)
+}
+
+// Muster für LIKE zur Suche nach Werten, die mit dem angegebenen Text beginnen
+func likePrefix(prefix string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(prefix) + "%"
+}
+
+func (source *SQLSource) PatientIds(ctx context.Context, selection Selection) ([]string, error) {
+	condition := ""
+	switch selection.Filter {
+	case OcaPlusOnly:
+		condition = "panel = 'OCAPlus' AND "
+	case WesOnly:
+		condition = "artdersequenzierung = 'WES' AND "
+	case WgsOnly:
+		condition = "artdersequenzierung = 'WGS' AND "
+	}
+
+	selectionCondition, selectionArgs := selectionCondition(selection, "prozedur", "dk_molekulargenetik")
+
+	query := `SELECT DISTINCT patienten_id FROM dk_molekulargenetik
+		JOIN prozedur ON (prozedur.id = dk_molekulargenetik.id)
+		JOIN patient ON (patient.id = prozedur.patient_id)
+		WHERE ` + condition + `prozedur.geloescht = 0` + source.persStammCondition("patient") + selectionCondition + `
+		ORDER BY patienten_id;`
+
+	var patientenIds []string
+
+	if rows, err := source.query(ctx, query, append(source.persStammArgs(), selectionArgs...)...); err == nil {
+		defer closeRows(rows)
+		var patientenId sql.NullString
+		for rows.Next() {
+			if err := rows.Scan(&patientenId); err == nil {
+				patientenIds = append(patientenIds, patientenId.String)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	return patientenIds, nil
+}
+
+// Anzahl der Tumorkonferenzen eines MTB-Typs
+type MtbTypeCount struct {
+	MtbType string
+	Count   int
+}
+
+// Ermittelt alle Typen von Tumorkonferenzen (dk_tumorkonferenz.tk) mit Anzahl nicht gelöschter Tumorkonferenzen
+func (source *SQLSource) MtbTypes(ctx context.Context) ([]MtbTypeCount, error) {
+	query := `SELECT tk, COUNT(*) FROM dk_tumorkonferenz
+		JOIN prozedur ON (prozedur.id = dk_tumorkonferenz.id)
+		JOIN patient ON (patient.id = prozedur.patient_id)
+		WHERE prozedur.geloescht = 0` + source.persStammCondition("patient") + `
+		GROUP BY tk
+		ORDER BY tk`
+
+	rows, err := source.query(ctx, query, source.persStammArgs()...)
+	if err != nil {
+		return nil, err
+	}
+	defer closeRows(rows)
+
+	var result []MtbTypeCount
+	var mtbType sql.NullString
+	var count int
+	for rows.Next() {
+		if err := rows.Scan(&mtbType, &count); err == nil {
+			result = append(result, MtbTypeCount{MtbType: mtbType.String, Count: count})
+		}
+	}
+
+	return result, rows.Err()
+}
+
+func (source *SQLSource) Patients(ctx context.Context, patientIDs []string, mtbTypes []string) ([]PatientRecord, error) {
+	patientIDs, ambiguousErr, err := source.uniquePatientIds(ctx, patientIDs)
+	if err != nil {
+		return nil, fmt.Errorf("keine Daten zu Patienten gefunden: %w", err)
+	}
+
+	query := `SELECT DISTINCT
+	   patient.patienten_id,
+	   geschlecht,
+	   DATE_FORMAT(FROM_DAYS(DATEDIFF(now(),geburtsdatum)), '%Y')+0 AS geburtsdatum,
+	   sterbedatum,
+	   ki.karnofsky
+	   FROM patient
+	   -- karnofsky
+		  LEFT OUTER JOIN (
+				SELECT patienten_id, karnofsky, MAX(p.beginndatum) FROM dk_ukw_tb_basisdaten dutb
+					  JOIN dk_tumorkonferenz dt ON (dutb.id = dt.id AND dt.tk IN (` + placeholders(len(mtbTypes)) + `))
+					  JOIN prozedur p ON (p.id = dutb.id)
+					  JOIN patient pat ON (pat.id = p.patient_id)
+					  WHERE dutb.karnofsky IS NOT NULL AND p.geloescht = 0` + source.persStammCondition("pat") + `
+					  GROUP BY patienten_id
+					  ORDER BY patienten_id
+		  ) ki ON (ki.patienten_id = patient.patienten_id)
+		  WHERE patient.patienten_id IN (` + placeholders(len(patientIDs)) + `)` + source.persStammCondition("patient") + `
+		  ORDER BY patient.patienten_id;`
+
+	var results []PatientRecord
+	if len(patientIDs) == 0 {
+		return results, ambiguousErr
+	}
+
+	args := append(queryArgs(mtbTypes), source.persStammArgs()...)
+	args = append(args, queryArgs(patientIDs)...)
+	args = append(args, source.persStammArgs()...)
+
+	rows, err := source.query(ctx, query, args...)
+	if err == nil {
+		defer closeRows(rows)
+		var patientenId sql.NullString
+		var sex sql.NullString
+		var geburtsdatum sql.NullInt16
+		var sterbedatum sql.NullString
+		var karnofsky sql.NullString
+
+		for rows.Next() {
+			if err := rows.Scan(&patientenId, &sex, &geburtsdatum, &sterbedatum, &karnofsky); err == nil {
+				record := PatientRecord{
+					PatientID:   patientenId.String,
+					Geschlecht:  nullString(sex),
+					Sterbedatum: nullString(sterbedatum),
+					Karnofsky:   nullString(karnofsky),
+				}
+				if geburtsdatum.Valid {
+					alter := int(geburtsdatum.Int16)
+					record.Alter = &alter
+				}
+				results = append(results, record)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		return results, ambiguousErr
+	}
+
+	return nil, fmt.Errorf("keine Daten zu Patienten gefunden: %w", err)
+}
+
+func (source *SQLSource) Diagnoses(ctx context.Context, patientIds []string, mtbTypes []string, allTk bool) (map[string]DiagnosesRecord, error) {
+	result := map[string]DiagnosesRecord{}
+	patientIds, _, err := source.uniquePatientIds(ctx, patientIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(patientIds) == 0 {
+		return result, nil
+	}
+
+	if err := source.mainDiagnoses(ctx, patientIds, mtbTypes, allTk, result); err != nil {
+		return nil, err
+	}
+	if err := source.allDiagnoses(ctx, patientIds, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Ermittelt die Hauptdiagnose, also die zuletzt begonnene Diagnose einer Erkrankung mit MTB
+func (source *SQLSource) mainDiagnoses(ctx context.Context, patientIds []string, mtbTypes []string, allTk bool, result map[string]DiagnosesRecord) error {
+	query := `SELECT
+		p.patienten_id,
+		icdo3histologie,
+		beginndatum,
+		icd10,
+		fernmetastasen,
+		pcve.shortdesc AS diagnose,
+		ROUND(DATEDIFF(IF(sterbedatum IS NULL, NOW(), sterbedatum),diagnosedatum) / 30) AS os_month,
+		YEAR(sub.first_mtb) AS first_mtb_year
+		FROM prozedur
+		JOIN dk_diagnose ON prozedur.id = dk_diagnose.id
+		JOIN property_catalogue_version_entry pcve ON pcve.code = icd10 AND pcve.property_version_id = icd10_propcat_version
+		JOIN patient p on p.id = prozedur.patient_id
+		JOIN erkrankung_prozedur ep ON ep.prozedur_id = prozedur.id
+		LEFT OUTER JOIN (
+			SELECT erkrankung_id, MIN(beginndatum) AS first_mtb FROM prozedur p
+				JOIN dk_tumorkonferenz dt ON (p.id = dt.id AND dt.tk IN (` + placeholders(len(mtbTypes)) + `))
+				JOIN erkrankung_prozedur ep ON (ep.prozedur_id = p.id)
+				GROUP BY erkrankung_id
+		) sub ON (sub.erkrankung_id = ep.erkrankung_id)
+		WHERE prozedur.geloescht = 0 AND p.patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("p") + ` AND ep.erkrankung_id IN (
+			SELECT ep.erkrankung_id FROM dk_tumorkonferenz
+				JOIN prozedur pro on dk_tumorkonferenz.id = pro.id
+				JOIN patient pat on pro.patient_id = pat.id
+				JOIN erkrankung_prozedur ep ON ep.prozedur_id = pro.id
+				WHERE pat.patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("pat") + ` AND (dk_tumorkonferenz.tk IN (` + placeholders(len(mtbTypes)) + `) OR 1 = ?)
+		)
+		ORDER BY p.patienten_id, beginndatum DESC, prozedur.id;`
+
+	args := append(queryArgs(mtbTypes), queryArgs(patientIds)...)
+	args = append(args, source.persStammArgs()...)
+	args = append(args, queryArgs(patientIds)...)
+	args = append(args, source.persStammArgs()...)
+	args = append(args, queryArgs(mtbTypes)...)
+	args = append(args, allTk)
+
+	rows, err := source.query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer closeRows(rows)
+
+	var patientID string
+	var icdo3histologie sql.NullString
+	var beginndatum sql.NullString
+	var icd10 sql.NullString
+	var fernmetastasen sql.NullString
+	var diagnose sql.NullString
+	var osMonth sql.NullInt16
+	var firstMtbYear sql.NullString
+
+	for rows.Next() {
+		if err := rows.Scan(&patientID, &icdo3histologie, &beginndatum, &icd10, &fernmetastasen, &diagnose, &osMonth, &firstMtbYear); err != nil {
+			continue
+		}
+		diagnoses := result[patientID]
+		if diagnoses.Main != nil {
+			continue
+		}
+		diagnoses.Main = &DiagnosisRecord{
+			Icdo3Histologie: nullString(icdo3histologie),
+			Beginndatum:     nullString(beginndatum),
+			Icd10:           nullString(icd10),
+			Fernmetastasen:  nullString(fernmetastasen),
+			Diagnose:        nullString(diagnose),
+			FirstMtbYear:    nullString(firstMtbYear),
+		}
+		if osMonth.Valid {
+			months := int(osMonth.Int16)
+			diagnoses.Main.OsMonths = &months
+		}
+		result[patientID] = diagnoses
+	}
+
+	return rows.Err()
+}
+
+// Ermittelt die Bezeichnungen aller Diagnosen, zuletzt begonnene zuerst
+func (source *SQLSource) allDiagnoses(ctx context.Context, patientIds []string, result map[string]DiagnosesRecord) error {
+	// Erforderlich: Beruecksichtigung von Krankheiten in "Anamnesebogen"?
+	query := `SELECT p.patienten_id, pcve.shortdesc, MAX(beginndatum) AS letzte_diagnose
+		FROM prozedur
+		JOIN dk_diagnose ON prozedur.id = dk_diagnose.id
+		JOIN property_catalogue_version_entry pcve ON pcve.code = icd10 AND pcve.property_version_id = icd10_propcat_version
+		JOIN erkrankung_prozedur ep ON prozedur.id = ep.prozedur_id
+		JOIN patient p on p.id = prozedur.patient_id
+		WHERE p.patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("p") + `
+		GROUP BY p.patienten_id, pcve.shortdesc
+		ORDER BY p.patienten_id, letzte_diagnose DESC, pcve.shortdesc`
+
+	rows, err := source.query(ctx, query, append(queryArgs(patientIds), source.persStammArgs()...)...)
+	if err != nil {
+		return err
+	}
+	defer closeRows(rows)
+
+	var patientID string
+	var erkrankung sql.NullString
+	var letzteDiagnose sql.NullString
+
+	for rows.Next() {
+		if err := rows.Scan(&patientID, &erkrankung, &letzteDiagnose); err == nil {
+			diagnoses := result[patientID]
+			diagnoses.All = append(diagnoses.All, erkrankung.String)
+			result[patientID] = diagnoses
+		}
+	}
+
+	return rows.Err()
+}
+
+// Erzeugt eine Liste von Platzhaltern für eine IN-Bedingung
+func placeholders(count int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", count), ",")
+}
+
+func queryArgs(values []string) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+// Fügt alle existierenden Patienten mit leerer Liste von Untersuchungen zum Ergebnis hinzu
+func (source *SQLSource) existingPatients(ctx context.Context, patientIds []string, result map[string][]MolecularRecord) error {
+	query := `SELECT patienten_id FROM patient WHERE patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("patient")
+
+	rows, err := source.query(ctx, query, append(queryArgs(patientIds), source.persStammArgs()...)...)
+	if err != nil {
+		return err
+	}
+	defer closeRows(rows)
+
+	var patientID string
+	for rows.Next() {
+		if err := rows.Scan(&patientID); err == nil {
+			result[patientID] = []MolecularRecord{}
+		}
+	}
+
+	return rows.Err()
+}
+
+func (source *SQLSource) MolecularProcedures(ctx context.Context, patientIds []string, selection Selection) (map[string][]MolecularRecord, error) {
+	result := map[string][]MolecularRecord{}
+	patientIds, ambiguousErr, err := source.uniquePatientIds(ctx, patientIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(patientIds) == 0 {
+		return result, ambiguousErr
+	}
+
+	if err := source.existingPatients(ctx, patientIds, result); err != nil {
+		return nil, err
+	}
+
+	selectionCondition, selectionArgs := selectionCondition(selection, "prozedur", "dm")
+
+	// Erkrankungen mit zuletzt begonnener Prozedur zuerst, darin Untersuchungen absteigend nach Beginn
+	query := `SELECT
+		pat.patienten_id,
+		dm.id,
+		dm.datum,
+		dm.einsendenummer,
+		dm.probenmaterial,
+		dm.entnahmemethode,
+		dm.entnahmedatum,
+		dm.tumorzellgehalt,
+		dm.tumormutationalburden,
+		pcve.shortdesc as sample_location,
+		dm.nukleinsaeure,
+		pcve2.code as panel_code,
+		pcve2.shortdesc as panel,
+		dm.artdersequenzierung
+		FROM prozedur
+		JOIN patient pat ON pat.id = prozedur.patient_id
+		JOIN dk_molekulargenetik dm on prozedur.id = dm.id
+		JOIN erkrankung_prozedur ep on prozedur.id = ep.prozedur_id
+		JOIN (
+			SELECT ep.erkrankung_id, MAX(pro.beginndatum) AS letzte_prozedur FROM prozedur pro
+				JOIN patient pat ON pro.patient_id = pat.id
+				JOIN erkrankung_prozedur ep ON ep.prozedur_id = pro.id
+				WHERE pat.patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("pat") + `
+				GROUP BY ep.erkrankung_id
+		) erkrankung ON erkrankung.erkrankung_id = ep.erkrankung_id
+		LEFT JOIN property_catalogue_version_entry pcve ON pcve.code = icdo3lokalisation AND pcve.property_version_id = icdo3lokalisation_propcat_version
+		LEFT JOIN property_catalogue_version_entry pcve2 ON pcve2.code = panel AND pcve2.property_version_id = panel_propcat_version
+		WHERE prozedur.geloescht = 0 AND pat.patienten_id IN (` + placeholders(len(patientIds)) + `)` + source.persStammCondition("pat") + selectionCondition + `
+		ORDER BY pat.patienten_id, erkrankung.letzte_prozedur DESC, ep.erkrankung_id, prozedur.beginndatum DESC, dm.id`
+
+	args := append(queryArgs(patientIds), source.persStammArgs()...)
+	args = append(args, queryArgs(patientIds)...)
+	args = append(args, source.persStammArgs()...)
+	args = append(args, selectionArgs...)
+
+	rows, err := source.query(ctx, query, args...)
+	if err == nil {
+		defer closeRows(rows)
+
+		var patientID string
+		var id sql.NullString
+		var datum sql.NullString
+		var einsendenummer sql.NullString
+		var probenmaterial sql.NullString
+		var entnahmemethode sql.NullString
+		var entnahmedatum sql.NullString
+		var tumorzellgehalt sql.NullString
+		var tumormutationalburden sql.NullString
+		var sampleLocation sql.NullString
+		var nukleinsaeure sql.NullString
+		var panelCode sql.NullString
+		var panel sql.NullString
+		var artdersequenzierung sql.NullString
+
+		for rows.Next() {
+			if err := rows.Scan(
+				&patientID,
+				&id,
+				&datum,
+				&einsendenummer,
+				&probenmaterial,
+				&entnahmemethode,
+				&entnahmedatum,
+				&tumorzellgehalt,
+				&tumormutationalburden,
+				&sampleLocation,
+				&nukleinsaeure,
+				&panelCode,
+				&panel,
+				&artdersequenzierung,
+			); err == nil {
+				result[patientID] = append(result[patientID], MolecularRecord{
+					ProzedurID:            id.String,
+					Datum:                 nullString(datum),
+					Einsendenummer:        nullString(einsendenummer),
+					Probenmaterial:        nullString(probenmaterial),
+					Entnahmemethode:       nullString(entnahmemethode),
+					Entnahmedatum:         nullString(entnahmedatum),
+					Tumorzellgehalt:       nullString(tumorzellgehalt),
+					Tumormutationalburden: nullString(tumormutationalburden),
+					SampleLocation:        nullString(sampleLocation),
+					Nukleinsaeure:         nullString(nukleinsaeure),
+					PanelCode:             nullString(panelCode),
+					Panel:                 nullString(panel),
+					Artdersequenzierung:   nullString(artdersequenzierung),
+				})
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		return result, ambiguousErr
+	}
+
+	return nil, fmt.Errorf("Kann Daten nicht abrufen: %w", err)
+}
+
+func (source *SQLSource) Biomarkers(ctx context.Context, prozedurIds []string) (map[string]BiomarkerRecord, error) {
+	result := map[string]BiomarkerRecord{}
+	if len(prozedurIds) == 0 {
+		return result, nil
+	}
+
+	chunkSize := source.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	// Die Anzahl Untersuchungen je Patient ist nicht begrenzt, daher werden auch die Prozedur-IDs aufgeteilt
+	for chunk := range slices.Chunk(prozedurIds, chunkSize) {
+		if err := source.immunhisto(ctx, chunk, result); err != nil {
+			return nil, err
+		}
+		if err := source.komplexeBiomarker(ctx, chunk, result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Ermittelt Gen, TPS, ICS und CPS der Immunhistochemie. Verwendet wird jeweils der erste Eintrag.
+func (source *SQLSource) immunhisto(ctx context.Context, prozedurIds []string, result map[string]BiomarkerRecord) error {
+	query := `SELECT pp.prozedur1, gen, tps, ic_score, cps FROM dk_molekularimmunhisto
+		JOIN prozedur_prozedur pp ON pp.prozedur2 = dk_molekularimmunhisto.id
+		WHERE pp.prozedur1 IN (` + placeholders(len(prozedurIds)) + `)
+		ORDER BY pp.prozedur1, dk_molekularimmunhisto.id`
+
+	rows, err := source.query(ctx, query, queryArgs(prozedurIds)...)
+	if err != nil {
+		return err
+	}
+	defer closeRows(rows)
+
+	var prozedurID string
+	var gen sql.NullString
+	var tps sql.NullString
+	var icScore sql.NullString
+	var cps sql.NullString
+
+	for rows.Next() {
+		if err := rows.Scan(&prozedurID, &gen, &tps, &icScore, &cps); err == nil {
+			biomarker := result[prozedurID]
+			if biomarker.Immunhisto != nil {
+				continue
+			}
+			biomarker.Immunhisto = &ImmunhistoRecord{
+				Gen:     nullString(gen),
+				Tps:     nullString(tps),
+				IcScore: nullString(icScore),
+				Cps:     nullString(cps),
+			}
+			result[prozedurID] = biomarker
+		}
+	}
+
+	return rows.Err()
+}
+
+// Ermittelt MSI- und HRD-Werte sowie die TMB aus neuem Formular "OS.Molekulargenetik" ab rev 81
+func (source *SQLSource) komplexeBiomarker(ctx context.Context, prozedurIds []string, result map[string]BiomarkerRecord) error {
+	query := `SELECT pp.prozedur1, komplexerbiomarker, seqprozentwert, score, hrdlst, hrdtai, hrdloh, tumormutationalburden
+		FROM dk_molekluargenmsi
+		JOIN prozedur_prozedur pp ON pp.prozedur2 = dk_molekluargenmsi.id
+		WHERE pp.prozedur1 IN (` + placeholders(len(prozedurIds)) + `)
+		ORDER BY pp.prozedur1, dk_molekluargenmsi.id`
+
+	rows, err := source.query(ctx, query, queryArgs(prozedurIds)...)
+	if err != nil {
+		return err
+	}
+	defer closeRows(rows)
+
+	var prozedurID string
+	var komplexerBiomarker sql.NullString
+	var prozentwert sql.NullString
+	var score sql.NullString
+	var lst sql.NullString
+	var tai sql.NullString
+	var loh sql.NullString
+	var tumormutationalburden sql.NullString
+
+	for rows.Next() {
+		if err := rows.Scan(&prozedurID, &komplexerBiomarker, &prozentwert, &score, &lst, &tai, &loh, &tumormutationalburden); err != nil {
+			continue
+		}
+		biomarker := result[prozedurID]
+		switch komplexerBiomarker.String {
+		case "MSI":
+			if prozentwert.Valid {
+				biomarker.Msi = append(biomarker.Msi, prozentwert.String)
+			}
+		case "HRD":
+			biomarker.Hrd = append(biomarker.Hrd, HrdRecord{
+				Score: nullString(score),
+				Lst:   nullString(lst),
+				Tai:   nullString(tai),
+				Loh:   nullString(loh),
+			})
+		}
+		if tumormutationalburden.Valid {
+			biomarker.Tmb = append(biomarker.Tmb, tumormutationalburden.String)
+		}
+		result[prozedurID] = biomarker
+	}
+
+	return rows.Err()
+}
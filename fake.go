@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"os2cb/export"
+)
+
+// Gewichtete Diagnose mit zueinander passenden Codes
+type SyntheticDiagnosis struct {
+	Icd10     string  `json:"icd10"`
+	IcdO3     string  `json:"icdo3"`
+	Oncotree  string  `json:"oncotree"`
+	Diagnosis string  `json:"diagnosis"`
+	Weight    float64 `json:"weight"`
+}
+
+// Gewichtetes Sequenzierpanel
+type SyntheticPanel struct {
+	Code          string  `json:"code"`
+	Name          string  `json:"name"`
+	Nukleinsaeure string  `json:"nukleinsaeure"`
+	Platform      string  `json:"platform"`
+	Weight        float64 `json:"weight"`
+}
+
+// Verteilungen zur Erzeugung synthetischer Patienten- und Probendaten
+type SyntheticDistribution struct {
+	MaleRatio             float64              `json:"male_ratio"`
+	AgeMean               float64              `json:"age_mean"`
+	AgeSd                 float64              `json:"age_sd"`
+	AgeMin                int                  `json:"age_min"`
+	AgeMax                int                  `json:"age_max"`
+	EcogWeights           []float64            `json:"ecog_weights"`
+	DeceasedRatio         float64              `json:"deceased_ratio"`
+	OsMonthsMean          float64              `json:"os_months_mean"`
+	MetastasisRatio       float64              `json:"metastasis_ratio"`
+	FirstMtbYearMin       int                  `json:"first_mtb_year_min"`
+	FirstMtbYearMax       int                  `json:"first_mtb_year_max"`
+	Diagnoses             []SyntheticDiagnosis `json:"diagnoses"`
+	SampleMetastasisRatio float64              `json:"sample_metastasis_ratio"`
+	SampleBiopsyRatio     float64              `json:"sample_biopsy_ratio"`
+	TumorCellAmountMin    int                  `json:"tumor_cell_amount_min"`
+	TumorCellAmountMax    int                  `json:"tumor_cell_amount_max"`
+	TmbMean               float64              `json:"tmb_mean"`
+	Panels                []SyntheticPanel     `json:"panels"`
+}
+
+// Standardverteilung, orientiert an einer typischen MTB-Kohorte
+func DefaultSyntheticDistribution() SyntheticDistribution {
+	return SyntheticDistribution{
+		MaleRatio:       0.52,
+		AgeMean:         58,
+		AgeSd:           14,
+		AgeMin:          18,
+		AgeMax:          90,
+		EcogWeights:     []float64{0.35, 0.4, 0.15, 0.08, 0.02},
+		DeceasedRatio:   0.35,
+		OsMonthsMean:    24,
+		MetastasisRatio: 0.6,
+		FirstMtbYearMin: 2018,
+		FirstMtbYearMax: 2024,
+		Diagnoses: []SyntheticDiagnosis{
+			{Icd10: "C34.1", IcdO3: "8140/3", Oncotree: "LUAD", Diagnosis: "Boesartige Neubildung: Oberlappen (-Bronchus)", Weight: 18},
+			{Icd10: "C18.7", IcdO3: "8140/3", Oncotree: "COAD", Diagnosis: "Boesartige Neubildung: Colon sigmoideum", Weight: 12},
+			{Icd10: "C50.9", IcdO3: "8500/3", Oncotree: "IDC", Diagnosis: "Boesartige Neubildung: Brustdruese, nicht naeher bezeichnet", Weight: 12},
+			{Icd10: "C25.0", IcdO3: "8500/3", Oncotree: "PAAD", Diagnosis: "Boesartige Neubildung: Pankreaskopf", Weight: 10},
+			{Icd10: "C43.5", IcdO3: "8720/3", Oncotree: "SKCM", Diagnosis: "Boesartiges Melanom des Rumpfes", Weight: 8},
+			{Icd10: "C61", IcdO3: "8140/3", Oncotree: "PRAD", Diagnosis: "Boesartige Neubildung der Prostata", Weight: 8},
+			{Icd10: "C71.9", IcdO3: "9440/3", Oncotree: "GB", Diagnosis: "Boesartige Neubildung: Gehirn, nicht naeher bezeichnet", Weight: 8},
+			{Icd10: "C56", IcdO3: "8461/3", Oncotree: "HGSOC", Diagnosis: "Boesartige Neubildung des Ovars", Weight: 8},
+			{Icd10: "C16.0", IcdO3: "8140/3", Oncotree: "STAD", Diagnosis: "Boesartige Neubildung: Kardia", Weight: 8},
+			{Icd10: "C49.9", IcdO3: "8800/3", Oncotree: "SARCNOS", Diagnosis: "Boesartige Neubildung: Bindegewebe und andere Weichteilgewebe, nicht naeher bezeichnet", Weight: 8},
+		},
+		SampleMetastasisRatio: 0.4,
+		SampleBiopsyRatio:     0.6,
+		TumorCellAmountMin:    10,
+		TumorCellAmountMax:    90,
+		TmbMean:               6,
+		Panels: []SyntheticPanel{
+			{Code: "OCAPlus", Name: "Oncomine Comprehensive Assay Plus", Nukleinsaeure: "dnarna", Platform: "Thermo Fisher", Weight: 60},
+			{Code: "OncomineV3", Name: "Oncomine Comprehensive Assay v3", Nukleinsaeure: "dna", Platform: "Thermo Fisher", Weight: 20},
+			{Code: "AFPLung", Name: "Archer FusionPlex Lung", Nukleinsaeure: "rna", Platform: "Thermo Fisher", Weight: 20},
+		},
+	}
+}
+
+// Liest Verteilungen aus einer JSON-Datei. Nicht angegebene Werte werden aus der Standardverteilung übernommen.
+func ReadSyntheticDistribution(filename string) (SyntheticDistribution, error) {
+	distribution := DefaultSyntheticDistribution()
+	if len(filename) == 0 {
+		return distribution, nil
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return distribution, errors.New("fake: Datei mit Verteilungen kann nicht geöffnet werden")
+	}
+	if err := json.Unmarshal(content, &distribution); err != nil {
+		return distribution, errors.New("fake: Datei mit Verteilungen kann nicht gelesen werden")
+	}
+	if len(distribution.Diagnoses) == 0 || len(distribution.Panels) == 0 || len(distribution.EcogWeights) == 0 {
+		return distribution, errors.New("fake: Diagnosen, Panels und ECOG-Gewichtungen dürfen nicht leer sein")
+	}
+	if distribution.AgeMin > distribution.AgeMax || distribution.TumorCellAmountMin > distribution.TumorCellAmountMax || distribution.FirstMtbYearMin > distribution.FirstMtbYearMax {
+		return distribution, errors.New("fake: Ungültige Wertebereiche in Verteilungen")
+	}
+
+	return distribution, nil
+}
+
+// Erzeugt reproduzierbar synthetische Patienten- und Probendaten anhand eines Seeds
+type SyntheticGenerator struct {
+	distribution SyntheticDistribution
+	random       *rand.Rand
+}
+
+func NewSyntheticGenerator(distribution SyntheticDistribution, seed uint64) *SyntheticGenerator {
+	return &SyntheticGenerator{
+		distribution: distribution,
+		random:       rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// Wählt einen Index anhand der angegebenen Gewichtungen
+func (generator *SyntheticGenerator) weightedIndex(weights []float64) int {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	value := generator.random.Float64() * total
+	for idx, weight := range weights {
+		if value < weight {
+			return idx
+		}
+		value -= weight
+	}
+	return len(weights) - 1
+}
+
+func (generator *SyntheticGenerator) chance(ratio float64) bool {
+	return generator.random.Float64() < ratio
+}
+
+func (generator *SyntheticGenerator) intBetween(lower int, upper int) int {
+	return lower + generator.random.IntN(upper-lower+1)
+}
+
+// Erzeugt synthetische Patientendaten mit angegebener ID
+func (generator *SyntheticGenerator) Patient(id string) export.PatientData {
+	distribution := generator.distribution
+
+	diagnosisWeights := make([]float64, len(distribution.Diagnoses))
+	for idx, diagnosis := range distribution.Diagnoses {
+		diagnosisWeights[idx] = diagnosis.Weight
+	}
+	diagnosis := distribution.Diagnoses[generator.weightedIndex(diagnosisWeights)]
+
+	sex := "Female"
+	if generator.chance(distribution.MaleRatio) {
+		sex = "Male"
+	}
+	// Geschlechtsspezifische Diagnosen
+	if diagnosis.Icd10 == "C61" {
+		sex = "Male"
+	} else if diagnosis.Icd10 == "C56" {
+		sex = "Female"
+	}
+
+	age := int(math.Round(distribution.AgeMean + generator.random.NormFloat64()*distribution.AgeSd))
+	age = max(distribution.AgeMin, min(distribution.AgeMax, age))
+
+	osMonths := int(math.Round(generator.random.ExpFloat64() * distribution.OsMonthsMean))
+	osStatus := "LIVING"
+	if generator.chance(distribution.DeceasedRatio) {
+		osStatus = "DECEASED"
+	}
+
+	spreadOfDisease := ""
+	if generator.chance(distribution.MetastasisRatio) {
+		spreadOfDisease = "metastasiert"
+	}
+
+	return export.PatientData{
+		ID:                       id,
+		Gender:                   sex,
+		Sex:                      sex,
+		Age:                      fmt.Sprint(age),
+		IcdO3MorphCode:           diagnosis.IcdO3,
+		Diagnosis:                diagnosis.Diagnosis,
+		OncotreeCode:             diagnosis.Oncotree,
+		Icd10Code:                diagnosis.Icd10,
+		SpreadOfDisease:          spreadOfDisease,
+		MtbEcogStatus:            fmt.Sprint(generator.weightedIndex(distribution.EcogWeights)),
+		PastMalignantDisease:     "",
+		PretherapyProgress:       "NA",
+		NumSystemicPretherapy:    "NA",
+		PretherapyMedication:     "NA",
+		PretherapyMedicationNcit: "NA",
+		PretherapyBestResponse:   "NA",
+		PretherapyPfs:            "NA",
+		OsStatus:                 osStatus,
+		OsMonths:                 fmt.Sprintf("%d.0", osMonths),
+		DfsStatus:                "NA",
+		DfsMonths:                "NA",
+		XFirstMtbYear:            fmt.Sprint(generator.intBetween(distribution.FirstMtbYearMin, distribution.FirstMtbYearMax)),
+	}
+}
+
+// Ergänzt fehlende Probendaten ('NA' oder leer) mit synthetischen Werten
+func (generator *SyntheticGenerator) Sample(sample export.SampleData) export.SampleData {
+	distribution := generator.distribution
+
+	isMissing := func(value string) bool {
+		return len(value) == 0 || value == "NA"
+	}
+
+	if isMissing(sample.SampleLocRefPrimarus) {
+		sample.SampleLocRefPrimarus = "Primaertumor"
+		if generator.chance(distribution.SampleMetastasisRatio) {
+			sample.SampleLocRefPrimarus = "Metastase"
+		}
+	}
+
+	if isMissing(sample.SampleMethod) {
+		sample.SampleMethod = "Resektat"
+		if generator.chance(distribution.SampleBiopsyRatio) {
+			sample.SampleMethod = "Biopsie"
+		}
+	}
+
+	if isMissing(sample.TumorCellAmount) {
+		sample.TumorCellAmount = fmt.Sprint(generator.intBetween(distribution.TumorCellAmountMin, distribution.TumorCellAmountMax))
+	}
+
+	if isMissing(sample.SequencingDnaPanel) && isMissing(sample.FusionRnaPanel) {
+		panelWeights := make([]float64, len(distribution.Panels))
+		for idx, panel := range distribution.Panels {
+			panelWeights[idx] = panel.Weight
+		}
+		panel := distribution.Panels[generator.weightedIndex(panelWeights)]
+
+		sample.SequencingDnaPanel = "NA"
+		sample.SequencingDnaPlatform = "NA"
+		sample.FusionRnaPanel = "NA"
+		sample.SequencingRnaPlatform = "NA"
+		if panel.Nukleinsaeure == "dna" || panel.Nukleinsaeure == "dnarna" {
+			sample.SequencingDnaPanel = panel.Name
+			sample.SequencingDnaPlatform = panel.Platform
+		}
+		if panel.Nukleinsaeure == "rna" || panel.Nukleinsaeure == "dnarna" {
+			sample.FusionRnaPanel = panel.Name
+			sample.SequencingRnaPlatform = panel.Platform
+		}
+	}
+
+	if isMissing(sample.TmbScore) && !isMissing(sample.SequencingDnaPanel) {
+		sample.TmbScore = fmt.Sprintf("%.1f", generator.random.ExpFloat64()*distribution.TmbMean)
+	}
+
+	return sample
+}
+
+// Liest Proben-IDs aus einer MAF- oder VCF-Datei
+func readSampleIds(filename string, format string) ([]string, error) {
+	input, err := openInputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+
+	var sampleIds []string
+	seen := map[string]bool{}
+	collect := func(id string) string {
+		id = strings.TrimSpace(id)
+		if len(id) > 0 && !seen[id] {
+			seen[id] = true
+			sampleIds = append(sampleIds, id)
+		}
+		return id
+	}
+
+	switch format {
+	case MafFormat:
+		err = rewriteTsvColumns(input, io.Discard, mafColumns("Tumor_Sample_Barcode"), collect)
+	case VcfFormat:
+		err = readVcfSampleIds(input, collect)
+	default:
+		err = fmt.Errorf("fake: Dateiformat '%s' wird nicht unterstützt", format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return sampleIds, nil
+}
+
+// Liest die Proben-IDs aus der Kopfzeile '#CHROM' einer VCF-Datei. Die nachfolgenden Datenzeilen werden nicht gelesen.
+func readVcfSampleIds(in io.Reader, collect func(id string) string) error {
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.New("fake: Daten können nicht gelesen werden")
+		}
+		if strings.HasPrefix(line, "#CHROM") {
+			columns := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+			// Probenspalten folgen nach der Spalte FORMAT (Index 8)
+			for idx := 9; idx < len(columns); idx++ {
+				collect(columns[idx])
+			}
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Liest eine Zuordnung von Proben-IDs zu Patienten. Je Zeile eine Proben-ID und ein Patienten-Schlüssel,
+// getrennt durch Tabulator, Komma oder Semikolon.
+func readSampleGroups(filename string) (map[string]string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.New("fake: Zuordnungsdatei kann nicht geöffnet werden")
+	}
+
+	splitRegEx := regexp.MustCompile("\\s*[,;\t]\\s*")
+	groups := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		columns := splitRegEx.Split(line, -1)
+		if len(columns) < 2 {
+			return nil, fmt.Errorf("fake: Ungültige Zeile in Zuordnungsdatei: '%s'", line)
+		}
+		groups[columns[0]] = columns[1]
+	}
+
+	return groups, nil
+}
+
+// Ermittelt eine Funktion, die zu einer Proben-ID den Schlüssel des zugehörigen Fake-Patienten liefert.
+// Ohne Zuordnungsdatei oder Muster erhält jede Probe einen eigenen Fake-Patienten.
+func sampleGrouper(groupFile string, groupPattern string) (func(sampleID string) string, error) {
+	if len(groupFile) > 0 {
+		groups, err := readSampleGroups(groupFile)
+		if err != nil {
+			return nil, err
+		}
+		return func(sampleID string) string {
+			if group, ok := groups[sampleID]; ok {
+				return group
+			}
+			return sampleID
+		}, nil
+	}
+
+	if len(groupPattern) > 0 {
+		re, err := regexp.Compile(groupPattern)
+		if err != nil {
+			return nil, fmt.Errorf("fake: Ungültiges Muster '%s'", groupPattern)
+		}
+		// Benannte Gruppe 'patient', ansonsten erste Gruppe oder gesamter Treffer
+		groupIndex := re.SubexpIndex("patient")
+		if groupIndex < 0 && re.NumSubexp() > 0 {
+			groupIndex = 1
+		} else if groupIndex < 0 {
+			groupIndex = 0
+		}
+		return func(sampleID string) string {
+			if matches := re.FindStringSubmatch(sampleID); matches != nil && len(matches[groupIndex]) > 0 {
+				return matches[groupIndex]
+			}
+			return sampleID
+		}, nil
+	}
+
+	return func(sampleID string) string {
+		return sampleID
+	}, nil
+}
+
+// Ermittelt das Format der Eingabedatei für Fake-Patienten
+func fakeInputFormat(filename string, format string) (string, error) {
+	if format != "auto" {
+		return format, nil
+	}
+	if detected, err := detectFileFormat(filename); err == nil {
+		if detected == SegFormat {
+			return "", fmt.Errorf("fake: Dateiformat '%s' wird nicht unterstützt", detected)
+		}
+		return detected, nil
+	}
+	return "samples", nil
+}
+
+func naSampleData(patientID string, sampleID string) export.SampleData {
+	return export.SampleData{
+		PatientID:             patientID,
+		SampleID:              sampleID,
+		SampleLocRefPrimarus:  "NA",
+		SampleMethod:          "NA",
+		SampleLocation:        "NA",
+		SampleAge:             "NA",
+		TumorCellAmount:       "NA",
+		SequencingDnaPanel:    "NA",
+		SequencingDnaPlatform: "NA",
+		FusionRnaPanel:        "NA",
+		SequencingRnaPlatform: "NA",
+		TmbScore:              "NA",
+		Tps:                   "NA",
+		Ics:                   "NA",
+		Cps:                   "NA",
+		MsiIg:                 "NA",
+		MsiPcr:                "NA",
+		MsiPanel:              "NA",
+		Her2Fish:              "NA",
+		OtherExamination:      "NA",
+		OtherIhc:              "NA",
+		DakoScore:             "NA",
+		Fusions:               "NA",
+		SpliceVariants:        "NA",
+		Mutations:             "NA",
+		Cnv:                   "NA",
+		GimScore:              "NA",
+		HrdScore:              "NA",
+		Lst:                   "NA",
+		Tai:                   "NA",
+		HrdLoh:                "NA",
+	}
+}
+
+// Schreibt die Mutationsdaten der Eingabedatei mit angepassten Proben-IDs in die angegebene Datei
+func writeMutationsFile(inputFilename string, outputFilename string, format string, rewrite func(id string) string) error {
+	input, err := openInputFile(inputFilename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+
+	output, err := createOutputFile(outputFilename)
+	if err != nil {
+		return err
+	}
+
+	if format == VcfFormat {
+		err = rewriteVcfSampleIds(input, output, rewrite)
+	} else {
+		err = rewriteTsvColumns(input, output, mafColumns("Tumor_Sample_Barcode", "Matched_Norm_Sample_Barcode"), rewrite)
+	}
+	if err != nil {
+		_ = output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+func fakePatients(cli *CLI) {
+	format, err := fakeInputFormat(cli.FakePatients.Input, cli.FakePatients.InputFormat)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	if len(cli.FakePatients.MutationsFile) > 0 && format == "samples" {
+		log.Fatalln("fake: Mutationsdaten können nur aus MAF- oder VCF-Dateien erstellt werden")
+	}
+
+	groupOf, err := sampleGrouper(cli.FakePatients.GroupFile, cli.FakePatients.GroupPattern)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	// Proben-IDs in Proben- und Mutationsdaten
+	sampleIdOf := func(id string) string {
+		return strings.TrimSpace(id)
+	}
+	if cli.FakePatients.Anonymize {
+		sampleIdOf = sampleIDAnonymizer(newPseudonymizer(cli))
+	}
+
+	var sampleData []export.SampleData
+	if format == "samples" {
+		if r, err := ReadFile(cli.FakePatients.Input, sampleData); err == nil {
+			sampleData = r
+		} else {
+			log.Fatalln(err.Error())
+		}
+	} else {
+		if sampleIds, err := readSampleIds(cli.FakePatients.Input, format); err == nil {
+			for _, sampleID := range sampleIds {
+				sampleData = append(sampleData, naSampleData("", sampleID))
+			}
+		} else {
+			log.Fatalln(err.Error())
+		}
+	}
+
+	var generator *SyntheticGenerator
+	if cli.FakePatients.Synthetic {
+		if distribution, err := ReadSyntheticDistribution(cli.FakePatients.Distribution); err == nil {
+			generator = NewSyntheticGenerator(distribution, cli.FakePatients.Seed)
+		} else {
+			log.Fatalln(err.Error())
+		}
+	}
+
+	var uniquePatientKeys = make([]string, 0)
+	var fakePatients = make([]export.PatientData, 0)
+	var fixedSamples = make([]export.SampleData, 0)
+
+	// Ersetze PatientID
+	for _, sample := range sampleData {
+		patientKey := groupOf(sample.SampleID)
+		if !slices.Contains(uniquePatientKeys, patientKey) {
+			uniquePatientKeys = append(uniquePatientKeys, patientKey)
+		}
+
+		// Neue Fake-PatientID
+		fakePatientId := fmt.Sprintf("2000%d", slices.Index(uniquePatientKeys, patientKey))
+		sample.PatientID = fakePatientId
+		sample.SampleID = sampleIdOf(sample.SampleID)
+
+		if generator != nil {
+			sample = generator.Sample(sample)
+		}
+
+		fixedSamples = append(fixedSamples, sample)
+	}
+
+	// Für jeden unique Patienten
+	for idx := range uniquePatientKeys {
+		if generator != nil {
+			fakePatients = append(fakePatients, generator.Patient(fmt.Sprintf("2000%d", idx)))
+			continue
+		}
+
+		fakePatients = append(fakePatients, export.PatientData{
+			ID:                       fmt.Sprintf("2000%d", idx),
+			Gender:                   "NA",
+			Sex:                      "NA",
+			Age:                      "NA",
+			IcdO3MorphCode:           "NA",
+			Diagnosis:                "NA",
+			OncotreeCode:             "NA",
+			Icd10Code:                "NA",
+			SpreadOfDisease:          "NA",
+			MtbEcogStatus:            "NA",
+			PastMalignantDisease:     "NA",
+			PretherapyProgress:       "NA",
+			NumSystemicPretherapy:    "NA",
+			PretherapyMedication:     "NA",
+			PretherapyMedicationNcit: "NA",
+			PretherapyBestResponse:   "NA",
+			PretherapyPfs:            "NA",
+			OsStatus:                 "NA",
+			OsMonths:                 "NA",
+			DfsStatus:                "NA",
+			DfsMonths:                "NA",
+			XFirstMtbYear:            "NA",
+		})
+	}
+
+	if err := WriteFile(cli.FakePatients.PatientFile, fakePatients); err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	if err := WriteFile(cli.FakePatients.SamplesFile, fixedSamples); err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	if len(cli.FakePatients.MutationsFile) > 0 {
+		if err := writeMutationsFile(cli.FakePatients.Input, cli.FakePatients.MutationsFile, format, sampleIdOf); err != nil {
+			log.Fatalln(err.Error())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/alecthomas/kong"
+
+	"os2cb/export"
+)
+
+func TestShouldGenerateReproducibleSyntheticPatients(t *testing.T) {
+	first := NewSyntheticGenerator(DefaultSyntheticDistribution(), 42)
+	second := NewSyntheticGenerator(DefaultSyntheticDistribution(), 42)
+
+	for idx := range 10 {
+		id := strconv.Itoa(20000 + idx)
+		expected := first.Patient(id)
+		actual := second.Patient(id)
+		if actual != expected {
+			t.Logf("wrong patient: Expected %v, got %v", expected, actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldGenerateValidSyntheticPatientAttributes(t *testing.T) {
+	distribution := DefaultSyntheticDistribution()
+	generator := NewSyntheticGenerator(distribution, 1)
+
+	for idx := range 100 {
+		patient := generator.Patient(strconv.Itoa(idx))
+
+		if !slices.Contains([]string{"Male", "Female"}, patient.Sex) {
+			t.Logf("wrong sex: %s", patient.Sex)
+			t.Fail()
+		}
+
+		if age, err := strconv.Atoi(patient.Age); err != nil || age < distribution.AgeMin || age > distribution.AgeMax {
+			t.Logf("wrong age: %s", patient.Age)
+			t.Fail()
+		}
+
+		if !slices.Contains([]string{"0", "1", "2", "3", "4"}, patient.MtbEcogStatus) {
+			t.Logf("wrong ecog: %s", patient.MtbEcogStatus)
+			t.Fail()
+		}
+
+		if patient.Icd10Code == "C61" && patient.Sex != "Male" {
+			t.Logf("wrong sex for diagnosis %s: %s", patient.Icd10Code, patient.Sex)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldKeepExistingSampleAttributes(t *testing.T) {
+	generator := NewSyntheticGenerator(DefaultSyntheticDistribution(), 1)
+
+	actual := generator.Sample(export.SampleData{
+		SampleID:        "H1234-24",
+		SampleMethod:    "Biopsie",
+		TumorCellAmount: "NA",
+	})
+
+	if actual.SampleMethod != "Biopsie" {
+		t.Logf("wrong value: Expected %s, got %s", "Biopsie", actual.SampleMethod)
+		t.Fail()
+	}
+
+	if actual.TumorCellAmount == "NA" {
+		t.Logf("missing value for tumor cell amount")
+		t.Fail()
+	}
+}
+
+func TestShouldGroupSamplesByPattern(t *testing.T) {
+	groupOf, err := sampleGrouper("", "^(?P<patient>P\\d+)-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testsArgs := map[string]string{
+		"P1-T1": "P1",
+		"P1-T2": "P1",
+		"P2-T1": "P2",
+		"X3":    "X3",
+	}
+
+	for key, value := range testsArgs {
+		actual := groupOf(key)
+		if actual != value {
+			t.Logf("wrong group: Expected %s, got %s", value, actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldReadTumorSampleBarcodesFromMaf(t *testing.T) {
+	filename := t.TempDir() + "/input.maf"
+	content := "#version 2.4\n" +
+		"Hugo_Symbol\tTumor_Sample_Barcode\tMatched_Norm_Sample_Barcode\n" +
+		"TP53\tP1-T1\tP1-N\n" +
+		"KRAS\tP1-T1\tP1-N\n" +
+		"EGFR\tP2-T1\tP2-N\n"
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := readSampleIds(filename, MafFormat)
+	expected := []string{"P1-T1", "P2-T1"}
+	if err != nil || !slices.Equal(actual, expected) {
+		t.Logf("wrong sample ids: Expected %v, got %v", expected, actual)
+		t.Fail()
+	}
+}
+
+func TestShouldRunFakePatientsWithoutDatabase(t *testing.T) {
+	dir := t.TempDir()
+	input := dir + "/input.maf"
+	if err := os.WriteFile(input, []byte("Hugo_Symbol\tTumor_Sample_Barcode\nTP53\tP1-T1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	parse := jobStepParser([]kong.Option{kong.Name("os2cb")})
+	if _, _, err := parse([]string{"fake-patients", "--patient-file", dir + "/patients.tsv", "--samples-file", dir + "/samples.tsv"}); err == nil {
+		t.Log("expected error for fake-patients without input file")
+		t.Fail()
+	}
+
+	cli, _, err := parse([]string{"fake-patients", "--input", input, "--patient-file", dir + "/patients.tsv", "--samples-file", dir + "/samples.tsv"})
+	if err != nil {
+		t.Fatalf("cannot parse fake-patients without user and patients: %v", err)
+	}
+	fakePatients(cli)
+
+	for _, filename := range []string{"patients.tsv", "samples.tsv"} {
+		if _, err := os.Stat(dir + "/" + filename); err != nil {
+			t.Logf("missing output file %s: %v", filename, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldReadSampleIdsFromVcfHeaderOnly(t *testing.T) {
+	header := "##fileformat=VCFv4.2\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tP1-T1\tP1-N\tP1-T1\n"
+	// Datenzeilen nach der Kopfzeile dürfen nicht gelesen werden
+	input := io.MultiReader(strings.NewReader(header), iotest.ErrReader(errors.New("data read")))
+
+	var actual []string
+	err := readVcfSampleIds(input, func(id string) string {
+		actual = append(actual, id)
+		return id
+	})
+	expected := []string{"P1-T1", "P1-N", "P1-T1"}
+	if err != nil || !slices.Equal(actual, expected) {
+		t.Logf("wrong sample ids: Expected %v, got %v (%v)", expected, actual, err)
+		t.Fail()
+	}
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/gocarina/gocsv"
 	"github.com/xuri/excelize/v2"
+
+	"os2cb/export"
 )
 
 //go:embed resources/prefix-data_clinical_patient.tsv
@@ -19,7 +21,7 @@ var prefixDataClinicalPatient string
 var prefixDataClinicalSample string
 
 // Liest eine bestehende Datei ein
-func ReadFile[D PatientData | SampleData](filename string, data []D) ([]D, error) {
+func ReadFile[D export.PatientData | export.SampleData](filename string, data []D) ([]D, error) {
 	file, err := os.Open(filename)
 	defer func(file *os.File) {
 		err := file.Close()
@@ -38,7 +40,7 @@ func ReadFile[D PatientData | SampleData](filename string, data []D) ([]D, error
 }
 
 // Schreibt Daten in CSV/TSV Datei
-func WriteFile[D PatientData | SampleData](filename string, data []D) error {
+func WriteFile[D export.PatientData | export.SampleData](filename string, data []D) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return errors.New("file: Datei kann nicht geöffnet werden")
@@ -46,9 +48,9 @@ func WriteFile[D PatientData | SampleData](filename string, data []D) error {
 
 	if output, err := gocsv.MarshalString(data); err == nil {
 		// Prepend CSV comments bc cBioportal will result in errors without them
-		if reflect.TypeFor[[]D]() == reflect.TypeFor[[]PatientData]() {
+		if reflect.TypeFor[[]D]() == reflect.TypeFor[[]export.PatientData]() {
 			output = prefixDataClinicalPatient + output
-		} else if reflect.TypeFor[[]D]() == reflect.TypeFor[[]SampleData]() {
+		} else if reflect.TypeFor[[]D]() == reflect.TypeFor[[]export.SampleData]() {
 			output = prefixDataClinicalSample + output
 		}
 
@@ -63,7 +65,7 @@ func WriteFile[D PatientData | SampleData](filename string, data []D) error {
 }
 
 // Schreibt Daten in Xlsx Datei
-func WriteXlsxFile(filename string, patientData []PatientData, sampleData []SampleData) error {
+func WriteXlsxFile(filename string, patientData []export.PatientData, sampleData []export.SampleData) error {
 	file := excelize.NewFile()
 	defer func() {
 		if err := file.Close(); err != nil {
@@ -71,51 +73,69 @@ func WriteXlsxFile(filename string, patientData []PatientData, sampleData []Samp
 		}
 	}()
 
-	patientsIndex, _ := file.NewSheet("Patients Data")
-	samplesIndex, _ := file.NewSheet("Samples Data")
+	patientsIndex, err := file.NewSheet("Patients Data")
+	if err != nil {
+		return err
+	}
+	samplesIndex, err := file.NewSheet("Samples Data")
+	if err != nil {
+		return err
+	}
 
-	_ = addPatientData(file, patientsIndex, patientData)
-	_ = addSampleData(file, samplesIndex, sampleData)
+	if err := addPatientData(file, patientsIndex, patientData); err != nil {
+		return err
+	}
+	if err := addSampleData(file, samplesIndex, sampleData); err != nil {
+		return err
+	}
 
 	_ = file.DeleteSheet("Sheet1")
 
 	if err := file.SaveAs(filename); err != nil {
-		fmt.Println(err)
+		return fmt.Errorf("file: Datei kann nicht gespeichert werden: %w", err)
 	}
 
 	return nil
 }
 
-func addPatientData(file *excelize.File, index int, patientData []PatientData) error {
+func addPatientData(file *excelize.File, index int, patientData []export.PatientData) error {
 	file.SetActiveSheet(index)
 
-	for idx, columnHeader := range PatientDataHeaders() {
+	for idx, columnHeader := range export.PatientDataHeaders() {
 		cell := getExcelColumn(idx) + "1"
-		_ = file.SetCellValue("Patients Data", cell, columnHeader)
+		if err := file.SetCellValue("Patients Data", cell, columnHeader); err != nil {
+			return err
+		}
 	}
 
 	for row, data := range patientData {
 		for idx, value := range data.AsStringArray() {
 			cell := getExcelColumn(idx) + fmt.Sprint(row+2)
-			_ = file.SetCellValue("Patients Data", cell, value)
+			if err := file.SetCellValue("Patients Data", cell, value); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func addSampleData(file *excelize.File, index int, sampleData []SampleData) error {
+func addSampleData(file *excelize.File, index int, sampleData []export.SampleData) error {
 	file.SetActiveSheet(index)
 
-	for idx, columnHeader := range SampleDataHeaders() {
+	for idx, columnHeader := range export.SampleDataHeaders() {
 		cell := getExcelColumn(idx) + "1"
-		_ = file.SetCellValue("Samples Data", cell, columnHeader)
+		if err := file.SetCellValue("Samples Data", cell, columnHeader); err != nil {
+			return err
+		}
 	}
 
 	for row, data := range sampleData {
 		for idx, value := range data.AsStringArray() {
 			cell := getExcelColumn(idx) + fmt.Sprint(row+2)
-			_ = file.SetCellValue("Samples Data", cell, value)
+			if err := file.SetCellValue("Samples Data", cell, value); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"path/filepath"
+	"testing"
+)
 
 func TestShouldReturnExpectedColumn(t *testing.T) {
 
@@ -20,3 +23,11 @@ func TestShouldReturnExpectedColumn(t *testing.T) {
 	}
 
 }
+
+func TestShouldReturnErrorIfXlsxFileCannotBeSaved(t *testing.T) {
+	err := WriteXlsxFile(filepath.Join(t.TempDir(), "missing", "export.xlsx"), nil, nil)
+	if err == nil {
+		t.Log("expected error for missing directory")
+		t.Fail()
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"os2cb/export"
+)
+
+// Schema der von os2cb verwendeten Onkostar-Tabellen. Es werden nur die Spalten angelegt, die in den Abfragen
+// verwendet werden.
+func OnkostarSchema() []string {
+	return []string{
+		`CREATE TABLE patient (
+			id INT NOT NULL PRIMARY KEY,
+			patienten_id VARCHAR(255),
+			personenstamm_id INT,
+			geschlecht VARCHAR(1),
+			geburtsdatum DATE,
+			sterbedatum DATE
+		)`,
+		`CREATE TABLE prozedur (
+			id INT NOT NULL PRIMARY KEY,
+			patient_id INT NOT NULL,
+			beginndatum DATE,
+			geloescht TINYINT NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE erkrankung (
+			id INT NOT NULL PRIMARY KEY,
+			patient_id INT NOT NULL
+		)`,
+		`CREATE TABLE erkrankung_prozedur (
+			erkrankung_id INT NOT NULL,
+			prozedur_id INT NOT NULL,
+			PRIMARY KEY (erkrankung_id, prozedur_id)
+		)`,
+		`CREATE TABLE prozedur_prozedur (
+			prozedur1 INT NOT NULL,
+			prozedur2 INT NOT NULL,
+			PRIMARY KEY (prozedur1, prozedur2)
+		)`,
+		`CREATE TABLE property_catalogue_version_entry (
+			id INT NOT NULL PRIMARY KEY,
+			property_version_id INT NOT NULL,
+			code VARCHAR(255),
+			shortdesc VARCHAR(255)
+		)`,
+		`CREATE TABLE dk_diagnose (
+			id INT NOT NULL PRIMARY KEY,
+			diagnosedatum DATE,
+			icd10 VARCHAR(255),
+			icd10_propcat_version INT,
+			icdo3histologie VARCHAR(255),
+			fernmetastasen TINYINT
+		)`,
+		`CREATE TABLE dk_tumorkonferenz (
+			id INT NOT NULL PRIMARY KEY,
+			tk VARCHAR(255)
+		)`,
+		`CREATE TABLE dk_ukw_tb_basisdaten (
+			id INT NOT NULL PRIMARY KEY,
+			karnofsky VARCHAR(255)
+		)`,
+		`CREATE TABLE dk_molekulargenetik (
+			id INT NOT NULL PRIMARY KEY,
+			datum DATE,
+			einsendenummer VARCHAR(255),
+			probenmaterial VARCHAR(255),
+			entnahmemethode VARCHAR(255),
+			entnahmedatum DATE,
+			tumorzellgehalt VARCHAR(255),
+			tumormutationalburden VARCHAR(255),
+			icdo3lokalisation VARCHAR(255),
+			icdo3lokalisation_propcat_version INT,
+			nukleinsaeure VARCHAR(255),
+			panel VARCHAR(255),
+			panel_propcat_version INT,
+			artdersequenzierung VARCHAR(255)
+		)`,
+		`CREATE TABLE dk_molekularimmunhisto (
+			id INT NOT NULL PRIMARY KEY,
+			gen VARCHAR(255),
+			tps VARCHAR(255),
+			ic_score VARCHAR(255),
+			cps VARCHAR(255)
+		)`,
+		`CREATE TABLE dk_molekluargenmsi (
+			id INT NOT NULL PRIMARY KEY,
+			komplexerbiomarker VARCHAR(255),
+			seqprozentwert VARCHAR(255),
+			score VARCHAR(255),
+			hrdlst VARCHAR(255),
+			hrdtai VARCHAR(255),
+			hrdloh VARCHAR(255),
+			tumormutationalburden VARCHAR(255)
+		)`,
+	}
+}
+
+// Versionen der Merkmalskataloge in property_catalogue_version_entry
+const (
+	icd10PropcatVersion       = 1
+	icdo3LokPropcatVersion    = 2
+	panelPropcatVersion       = 3
+	fixtureMtbType            = "27"
+	fixtureOtherTumorConfType = "1"
+	fixturePersStamm          = 4
+)
+
+// Topographie (ICD-O-3) zum ICD-10-Code einer synthetischen Diagnose
+var fixtureLocations = map[string]string{
+	"C34.1": "Oberlappen (-Bronchus)",
+	"C18.7": "Colon sigmoideum",
+	"C50.9": "Brustdruese, nicht naeher bezeichnet",
+	"C25.0": "Pankreaskopf",
+	"C43.5": "Haut des Rumpfes",
+	"C61":   "Prostata",
+	"C71.9": "Gehirn, nicht naeher bezeichnet",
+	"C56":   "Ovar",
+	"C16.0": "Kardia",
+	"C49.9": "Bindegewebe und andere Weichteilgewebe, nicht naeher bezeichnet",
+}
+
+// Erzeugt eine synthetische Onkostar-Datenbank als Folge von SQL-Anweisungen
+type OnkostarFixture struct {
+	generator     *SyntheticGenerator
+	referenceDate time.Time
+	statements    []string
+	nextID        int
+	nextSampleNr  int
+}
+
+func NewOnkostarFixture(distribution SyntheticDistribution, seed uint64, referenceDate time.Time) *OnkostarFixture {
+	return &OnkostarFixture{
+		generator:     NewSyntheticGenerator(distribution, seed),
+		referenceDate: referenceDate,
+		nextID:        1,
+		nextSampleNr:  1000,
+	}
+}
+
+// Formatiert einen Wert als SQL-Literal
+func sqlLiteral(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		v = strings.ReplaceAll(v, "\\", "\\\\")
+		v = strings.ReplaceAll(v, "'", "''")
+		return "'" + v + "'"
+	case time.Time:
+		return "'" + v.Format("2006-01-02") + "'"
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (fixture *OnkostarFixture) insert(table string, columns []string, values ...any) {
+	literals := make([]string, len(values))
+	for idx, value := range values {
+		literals[idx] = sqlLiteral(value)
+	}
+	fixture.statements = append(fixture.statements, fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(columns, ", "),
+		strings.Join(literals, ", "),
+	))
+}
+
+func (fixture *OnkostarFixture) id() int {
+	id := fixture.nextID
+	fixture.nextID++
+	return id
+}
+
+// Datum relativ zum Referenzdatum
+func (fixture *OnkostarFixture) daysBefore(days int) time.Time {
+	return fixture.referenceDate.AddDate(0, 0, -days)
+}
+
+func (fixture *OnkostarFixture) prozedur(patientID int, erkrankungID int, beginndatum time.Time, geloescht bool) int {
+	id := fixture.id()
+	fixture.insert("prozedur", []string{"id", "patient_id", "beginndatum", "geloescht"}, id, patientID, beginndatum, geloescht)
+	if erkrankungID > 0 {
+		fixture.insert("erkrankung_prozedur", []string{"erkrankung_id", "prozedur_id"}, erkrankungID, id)
+	}
+	return id
+}
+
+// Unterformular einer Hauptprozedur, verknüpft über prozedur_prozedur
+func (fixture *OnkostarFixture) subProzedur(patientID int, parentID int, beginndatum time.Time) int {
+	id := fixture.prozedur(patientID, 0, beginndatum, false)
+	fixture.insert("prozedur_prozedur", []string{"prozedur1", "prozedur2"}, parentID, id)
+	return id
+}
+
+func (fixture *OnkostarFixture) catalogue() {
+	id := 1
+	for _, diagnosis := range fixture.generator.distribution.Diagnoses {
+		fixture.insert("property_catalogue_version_entry", []string{"id", "property_version_id", "code", "shortdesc"},
+			id, icd10PropcatVersion, diagnosis.Icd10, diagnosis.Diagnosis)
+		id++
+		if location, ok := fixtureLocations[diagnosis.Icd10]; ok {
+			fixture.insert("property_catalogue_version_entry", []string{"id", "property_version_id", "code", "shortdesc"},
+				id, icdo3LokPropcatVersion, diagnosis.Icd10, location)
+			id++
+		}
+	}
+	for _, panel := range fixture.generator.distribution.Panels {
+		fixture.insert("property_catalogue_version_entry", []string{"id", "property_version_id", "code", "shortdesc"},
+			id, panelPropcatVersion, panel.Code, panel.Name)
+		id++
+	}
+}
+
+// Erzeugt eine Erkrankung mit Diagnose und optional MTB, Molekulargenetik und Biomarkern
+func (fixture *OnkostarFixture) erkrankung(patientID int, patient export.PatientData, withMtb bool, daysAgo int) {
+	random := fixture.generator.random
+	distribution := fixture.generator.distribution
+
+	erkrankungID := fixture.id()
+	fixture.insert("erkrankung", []string{"id", "patient_id"}, erkrankungID, patientID)
+
+	// Diagnose der Erkrankung. Vorerkrankungen erhalten eine zufällige Diagnose.
+	icd10 := patient.Icd10Code
+	icdo3 := patient.IcdO3MorphCode
+	if !withMtb {
+		diagnosis := distribution.Diagnoses[random.IntN(len(distribution.Diagnoses))]
+		icd10 = diagnosis.Icd10
+		icdo3 = diagnosis.IcdO3
+	}
+	diagnoseID := fixture.prozedur(patientID, erkrankungID, fixture.daysBefore(daysAgo), false)
+	fixture.insert("dk_diagnose", []string{"id", "diagnosedatum", "icd10", "icd10_propcat_version", "icdo3histologie", "fernmetastasen"},
+		diagnoseID, fixture.daysBefore(daysAgo), icd10, icd10PropcatVersion, icdo3, patient.SpreadOfDisease == "metastasiert")
+
+	if !withMtb {
+		return
+	}
+
+	// MTB mit Basisdaten (Karnofsky) und weitere Tumorkonferenz
+	mtbDaysAgo := daysAgo - fixture.generator.intBetween(14, 90)
+	tkID := fixture.prozedur(patientID, erkrankungID, fixture.daysBefore(mtbDaysAgo), false)
+	fixture.insert("dk_tumorkonferenz", []string{"id", "tk"}, tkID, fixtureMtbType)
+	karnofsky := []string{"100%", "80%", "60%", "40%", "20%"}[min(4, fixture.generator.weightedIndex(distribution.EcogWeights))]
+	fixture.insert("dk_ukw_tb_basisdaten", []string{"id", "karnofsky"}, tkID, karnofsky)
+
+	if fixture.generator.chance(0.3) {
+		otherTkID := fixture.prozedur(patientID, erkrankungID, fixture.daysBefore(daysAgo-7), false)
+		fixture.insert("dk_tumorkonferenz", []string{"id", "tk"}, otherTkID, fixtureOtherTumorConfType)
+	}
+
+	// Molekulargenetik vor dem MTB: ein bis zwei Proben, davon gelegentlich gelöscht
+	for range fixture.generator.intBetween(1, 2) {
+		fixture.molekulargenetik(patientID, erkrankungID, patient, mtbDaysAgo+fixture.generator.intBetween(1, 30))
+	}
+}
+
+func (fixture *OnkostarFixture) molekulargenetik(patientID int, erkrankungID int, patient export.PatientData, daysAgo int) {
+	random := fixture.generator.random
+	distribution := fixture.generator.distribution
+
+	panelWeights := make([]float64, len(distribution.Panels))
+	for idx, panel := range distribution.Panels {
+		panelWeights[idx] = panel.Weight
+	}
+	panel := distribution.Panels[fixture.generator.weightedIndex(panelWeights)]
+
+	artdersequenzierung := "PAN"
+	if fixture.generator.chance(0.15) {
+		artdersequenzierung = []string{"WES", "WGS"}[random.IntN(2)]
+	}
+
+	probenmaterial := "T"
+	if fixture.generator.chance(distribution.SampleMetastasisRatio) {
+		probenmaterial = "M"
+	}
+	entnahmemethode := "R"
+	if fixture.generator.chance(distribution.SampleBiopsyRatio) {
+		entnahmemethode = "B"
+	}
+
+	datum := fixture.daysBefore(daysAgo)
+	fixture.nextSampleNr++
+	einsendenummer := fmt.Sprintf("H/%d/%d", datum.Year(), fixture.nextSampleNr)
+
+	// Alter TMB-Wert aus Formular vor rev 81
+	var alterTmb any
+	if fixture.generator.chance(0.2) {
+		alterTmb = fmt.Sprintf("%.1f", random.ExpFloat64()*distribution.TmbMean)
+	}
+
+	id := fixture.prozedur(patientID, erkrankungID, datum, fixture.generator.chance(0.05))
+	fixture.insert("dk_molekulargenetik", []string{
+		"id", "datum", "einsendenummer", "probenmaterial", "entnahmemethode", "entnahmedatum", "tumorzellgehalt",
+		"tumormutationalburden", "icdo3lokalisation", "icdo3lokalisation_propcat_version", "nukleinsaeure", "panel",
+		"panel_propcat_version", "artdersequenzierung",
+	},
+		id, datum, einsendenummer, probenmaterial, entnahmemethode, fixture.daysBefore(daysAgo+fixture.generator.intBetween(1, 60)),
+		fmt.Sprint(fixture.generator.intBetween(distribution.TumorCellAmountMin, distribution.TumorCellAmountMax)),
+		alterTmb, patient.Icd10Code, icdo3LokPropcatVersion, panel.Nukleinsaeure, panel.Code,
+		panelPropcatVersion, artdersequenzierung,
+	)
+
+	// PD-L1 Immunhistochemie
+	if fixture.generator.chance(0.6) {
+		ihcID := fixture.subProzedur(patientID, id, datum)
+		fixture.insert("dk_molekularimmunhisto", []string{"id", "gen", "tps", "ic_score", "cps"},
+			ihcID, "PDL1", fmt.Sprint(random.IntN(101)), fmt.Sprint(random.IntN(4)), fmt.Sprint(random.IntN(101)))
+	}
+
+	// MSI
+	if fixture.generator.chance(0.7) {
+		msiID := fixture.subProzedur(patientID, id, datum)
+		fixture.insert("dk_molekluargenmsi", []string{"id", "komplexerbiomarker", "seqprozentwert"},
+			msiID, "MSI", fmt.Sprintf("%.1f", random.Float64()*30))
+	}
+
+	// HRD
+	if fixture.generator.chance(0.4) {
+		hrdID := fixture.subProzedur(patientID, id, datum)
+		fixture.insert("dk_molekluargenmsi", []string{"id", "komplexerbiomarker", "score", "hrdlst", "hrdtai", "hrdloh"},
+			hrdID, "HRD", fmt.Sprint(random.IntN(100)), fmt.Sprint(random.IntN(40)), fmt.Sprint(random.IntN(40)), fmt.Sprint(random.IntN(30)))
+	}
+
+	// TMB aus Formular ab rev 81
+	if fixture.generator.chance(0.6) {
+		tmbID := fixture.subProzedur(patientID, id, datum)
+		fixture.insert("dk_molekluargenmsi", []string{"id", "komplexerbiomarker", "tumormutationalburden"},
+			tmbID, "TMB", fmt.Sprintf("%.1f", random.ExpFloat64()*distribution.TmbMean))
+	}
+}
+
+// Erzeugt Schema und Daten für die angegebene Anzahl an Patienten
+func (fixture *OnkostarFixture) Generate(patients int, withSchema bool) []string {
+	fixture.statements = []string{}
+	if withSchema {
+		fixture.statements = append(fixture.statements, OnkostarSchema()...)
+	}
+
+	fixture.catalogue()
+
+	for idx := range patients {
+		patientID := fixture.id()
+		patient := fixture.generator.Patient(fmt.Sprintf("2000%04d", idx+1))
+
+		geschlecht := "w"
+		if patient.Sex == "Male" {
+			geschlecht = "m"
+		}
+
+		var age int
+		_, _ = fmt.Sscan(patient.Age, &age)
+		geburtsdatum := fixture.daysBefore(age*365 + fixture.generator.intBetween(1, 300))
+
+		var osMonths int
+		_, _ = fmt.Sscanf(patient.OsMonths, "%d.0", &osMonths)
+		diagnoseDaysAgo := osMonths*30 + fixture.generator.intBetween(100, 200)
+
+		var sterbedatum any
+		if patient.OsStatus == "DECEASED" {
+			sterbedatum = fixture.daysBefore(fixture.generator.intBetween(1, 90))
+		}
+
+		fixture.insert("patient", []string{"id", "patienten_id", "personenstamm_id", "geschlecht", "geburtsdatum", "sterbedatum"},
+			patientID, patient.ID, fixturePersStamm, geschlecht, geburtsdatum, sterbedatum)
+
+		// Gelegentlich eine frühere Erkrankung ohne MTB
+		if fixture.generator.chance(0.15) {
+			fixture.erkrankung(patientID, patient, false, diagnoseDaysAgo+fixture.generator.intBetween(365, 3650))
+		}
+		fixture.erkrankung(patientID, patient, true, diagnoseDaysAgo)
+	}
+
+	return fixture.statements
+}
+
+// Schreibt die SQL-Anweisungen als Skript
+func WriteSqlScript(out io.Writer, statements []string) error {
+	for _, statement := range statements {
+		if _, err := fmt.Fprintf(out, "%s;\n", statement); err != nil {
+			return fmt.Errorf("fixture: SQL-Skript kann nicht geschrieben werden")
+		}
+	}
+	return nil
+}
+
+// Prüft, dass die Datenbank keine Patienten und Prozeduren enthält, damit synthetische Daten nicht in eine
+// bestehende Onkostar-Datenbank geschrieben werden. Nicht vorhandene Tabellen gelten als leer.
+func CheckEmptyOnkostar(db *sql.DB) error {
+	for _, table := range []string{"patient", "prozedur"} {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("fixture: Tabelle '%s' kann nicht geprüft werden: %w", table, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("fixture: Tabelle '%s' enthält bereits Daten, es werden keine synthetischen Daten erzeugt", table)
+		}
+	}
+	return nil
+}
+
+// Führt die SQL-Anweisungen in der angegebenen Datenbank aus
+func ExecuteSqlStatements(db *sql.DB, statements []string) error {
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("fixture: Fehler beim Ausführen von '%s': %w", strings.SplitN(statement, "\n", 2)[0], err)
+		}
+	}
+	return nil
+}
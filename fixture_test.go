@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+func TestShouldFormatSqlLiterals(t *testing.T) {
+	testsArgs := map[string]any{
+		"NULL":         nil,
+		"'O''Brien'":   "O'Brien",
+		"'a\\\\b'":     "a\\b",
+		"'2024-01-31'": time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		"1":            true,
+		"42":           42,
+	}
+
+	for expected, value := range testsArgs {
+		actual := sqlLiteral(value)
+		if actual != expected {
+			t.Logf("wrong literal: Expected %s, got %s", expected, actual)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldGenerateReproducibleFixture(t *testing.T) {
+	referenceDate := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := NewOnkostarFixture(DefaultSyntheticDistribution(), 7, referenceDate).Generate(10, true)
+	second := NewOnkostarFixture(DefaultSyntheticDistribution(), 7, referenceDate).Generate(10, true)
+
+	if !slices.Equal(first, second) {
+		t.Logf("fixture statements differ for same seed")
+		t.Fail()
+	}
+
+	if len(first) <= len(OnkostarSchema()) {
+		t.Logf("missing fixture data")
+		t.Fail()
+	}
+}
+
+func TestShouldParseFakeOnkostarCommand(t *testing.T) {
+	parse := jobStepParser([]kong.Option{kong.Name("os2cb")})
+
+	if _, _, err := parse([]string{"fake-onkostar", "--output", "onkostar.sql"}); err != nil {
+		t.Logf("cannot parse fake-onkostar with output file: %v", err)
+		t.Fail()
+	}
+	if _, _, err := parse([]string{"--user", "root", "fake-onkostar", "--execute"}); err == nil {
+		t.Log("expected error for '--execute' without '--database'")
+		t.Fail()
+	}
+	if _, _, err := parse([]string{"--database", "synthetic", "fake-onkostar", "--execute"}); err == nil {
+		t.Log("expected error for '--execute' without '--user'")
+		t.Fail()
+	}
+	if actual, _, err := parse([]string{"--user", "root", "--database", "synthetic", "fake-onkostar", "--execute"}); err != nil || actual.Database != "synthetic" {
+		t.Logf("cannot parse fake-onkostar with explicit database: %v", err)
+		t.Fail()
+	}
+}
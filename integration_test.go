@@ -0,0 +1,974 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gocarina/gocsv"
+	"github.com/sirupsen/logrus"
+	"github.com/xuri/excelize/v2"
+
+	"os2cb/export"
+)
+
+var updateGolden = flag.Bool("update", false, "Golden-Dateien in testdata aktualisieren")
+
+// Stichtag der Onkostar-Fixtures. NOW() des Testservers liefert diesen Zeitpunkt.
+var fixtureReferenceDate = time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+
+const fixturePatients = 25
+const fixtureSeed = 4711
+
+var integrationDb *sql.DB
+
+// Adresse des gemeinsam genutzten Onkostar-Testservers
+var integrationAddress string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logrus.SetLevel(logrus.WarnLevel)
+
+	code := 0
+	_ = gmssql.RunWithNowFunc(func() time.Time {
+		return fixtureReferenceDate.Add(12 * time.Hour)
+	}, func() error {
+		code = m.Run()
+		return nil
+	})
+
+	if integrationDb != nil {
+		_ = integrationDb.Close()
+	}
+	os.Exit(code)
+}
+
+// Startet einen MySQL-kompatiblen Server im Prozess und befüllt diesen mit synthetischen Onkostar-Daten
+func startOnkostarServer(t testing.TB) *sql.DB {
+	t.Helper()
+
+	if integrationDb != nil {
+		return integrationDb
+	}
+
+	database := memory.NewDatabase("onkostar")
+	database.BaseDatabase.EnablePrimaryKeyIndexes()
+	provider := memory.NewDBProvider(database)
+	engine := sqle.NewDefault(provider)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	mysqlServer, err := server.NewServer(server.Config{Protocol: "tcp", Address: address}, engine, gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = mysqlServer.Start()
+	}()
+
+	dbCfg := mysql.Config{
+		User:                 "root",
+		Net:                  "tcp",
+		Addr:                 address,
+		DBName:               "onkostar",
+		AllowNativePasswords: true,
+	}
+
+	var dbx *sql.DB
+	for range 50 {
+		if dbx, err = initDb(dbCfg); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := NewOnkostarFixture(DefaultSyntheticDistribution(), fixtureSeed, fixtureReferenceDate).Generate(fixturePatients, true)
+	if err := ExecuteSqlStatements(dbx, statements); err != nil {
+		t.Fatal(err)
+	}
+
+	integrationDb = dbx
+	integrationAddress = address
+	return dbx
+}
+
+// Parst die Kommandozeile und führt den Befehl gegen den Testserver aus
+func runCommand(t *testing.T, args ...string) {
+	t.Helper()
+
+	db = startOnkostarServer(t)
+
+	cli = &CLI{}
+	parser, err := kong.New(cli, kong.Name("os2cb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kongContext, err = parser.Parse(append([]string{"--user", "root"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+
+	gocsv.SetCSVWriter(getCsvWriter(cli.ExportPatients.Csv || cli.ExportSamples.Csv))
+	gocsv.SetCSVReader(getCsvReader(cli.ExportPatients.Csv || cli.ExportSamples.Csv))
+
+	if err := executeCommand(t.Context(), cli, db); err != nil {
+		exitWithReport(err)
+	}
+}
+
+// Vergleicht die Ausgabe mit der Golden-Datei in testdata
+func assertGolden(t *testing.T, name string, actual string) {
+	t.Helper()
+
+	golden := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(golden, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("cannot read golden file %s: %s", golden, err)
+	}
+
+	if actual != string(expected) {
+		t.Logf("output differs from golden file %s:\n%s", golden, actual)
+		t.Fail()
+	}
+}
+
+func readOutput(t *testing.T, filename string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// Gibt alle Datenblätter einer Xlsx-Datei als TSV aus
+func dumpXlsx(t *testing.T, filename string) string {
+	t.Helper()
+
+	file, err := excelize.OpenFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var result strings.Builder
+	for _, sheet := range file.GetSheetList() {
+		rows, err := file.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result.WriteString(fmt.Sprintf("## %s\n", sheet))
+		for _, row := range rows {
+			result.WriteString(strings.Join(row, "\t") + "\n")
+		}
+	}
+	return result.String()
+}
+
+func TestIntegrationExportPatients(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "patients.tsv")
+	runCommand(t, "--all", "export-patients", "--filename", filename)
+	assertGolden(t, "export-patients.tsv", readOutput(t, filename))
+}
+
+func TestIntegrationExportPatientsWithPatientIds(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "patients.tsv")
+	runCommand(t, "--patient-id", "20000003,20000001", "--no-anon", "export-patients", "--filename", filename)
+	assertGolden(t, "export-patients-ids.tsv", readOutput(t, filename))
+}
+
+func TestIntegrationExportSamples(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "samples.tsv")
+	runCommand(t, "--all", "export-samples", "--filename", filename)
+	assertGolden(t, "export-samples.tsv", readOutput(t, filename))
+}
+
+func TestIntegrationExportSamplesOcaPlus(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "samples.tsv")
+	runCommand(t, "--oca-plus", "export-samples", "--filename", filename)
+	assertGolden(t, "export-samples-ocaplus.tsv", readOutput(t, filename))
+}
+
+func TestIntegrationExportSamplesWes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "samples.tsv")
+	runCommand(t, "--wes", "export-samples", "--filename", filename)
+	assertGolden(t, "export-samples-wes.tsv", readOutput(t, filename))
+}
+
+func TestIntegrationExportXlsx(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "export.xlsx")
+	runCommand(t, "--all", "export-xlsx", "--filename", filename)
+	assertGolden(t, "export-xlsx.tsv", dumpXlsx(t, filename))
+}
+
+func TestIntegrationFetchAllPatientIds(t *testing.T) {
+	db = startOnkostarServer(t)
+	exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}}, db, export.NoPseudonymizer{})
+
+	var expected int
+	query := `SELECT COUNT(DISTINCT patient_id) FROM prozedur JOIN dk_molekulargenetik dm ON dm.id = prozedur.id WHERE geloescht = 0`
+	if err := db.QueryRow(query).Scan(&expected); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := exporter.FetchPatientIds(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != expected {
+		t.Logf("wrong number of patients: Expected %d, got %d", expected, len(ids))
+		t.Fail()
+	}
+}
+
+func TestIntegrationChunkSizeShouldNotChangeResult(t *testing.T) {
+	db = startOnkostarServer(t)
+	patientIds, err := export.NewExporter(export.Config{MtbTypes: []string{"27"}}, db, nil).FetchPatientIds(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPatients, _ := export.NewExporter(export.Config{MtbTypes: []string{"27"}}, db, nil).FetchPatientData(t.Context(), patientIds)
+	expectedSamples, _ := export.NewExporter(export.Config{MtbTypes: []string{"27"}}, db, nil).FetchSampleData(t.Context(), patientIds)
+
+	exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}, ChunkSize: 3, Workers: 4}, db, nil)
+	patients, _ := exporter.FetchPatientData(t.Context(), patientIds)
+	samples, _ := exporter.FetchSampleData(t.Context(), patientIds)
+
+	if fmt.Sprint(patients) != fmt.Sprint(expectedPatients) {
+		t.Logf("patient data differs with chunk size 3 and 4 workers")
+		t.Fail()
+	}
+	if fmt.Sprint(samples) != fmt.Sprint(expectedSamples) {
+		t.Logf("sample data differs with chunk size 3 and 4 workers")
+		t.Fail()
+	}
+}
+
+// Vergleicht die Abfrage je Patient (Teilmengen mit einem Patienten) mit der Abfrage in Teilmengen
+func BenchmarkFetchPatientData(b *testing.B) {
+	onkostarDb := startOnkostarServer(b)
+	patientIds, err := export.NewExporter(export.Config{MtbTypes: []string{"27"}}, onkostarDb, nil).FetchPatientIds(b.Context())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, chunkSize := range []int{1, export.DefaultChunkSize} {
+		b.Run(fmt.Sprintf("chunk-%d", chunkSize), func(b *testing.B) {
+			exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}, ChunkSize: chunkSize}, onkostarDb, nil)
+			for b.Loop() {
+				if _, err := exporter.FetchPatientData(b.Context(), patientIds); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegrationExportPatientsWithQuotedPatientId(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "patients.tsv")
+	runCommand(t, "--patient-id", "20000003,2000'0002,20000001", "--no-anon", "--chunk-size", "2", "export-patients", "--filename", filename)
+	assertGolden(t, "export-patients-ids.tsv", readOutput(t, filename))
+}
+
+func TestIntegrationShouldStopOnCancel(t *testing.T) {
+	db = startOnkostarServer(t)
+	exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}}, db, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := exporter.FetchSampleData(ctx, []string{"20000001"}); !errors.Is(err, context.Canceled) {
+		t.Logf("expected context.Canceled, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationShouldApplyQueryTimeout(t *testing.T) {
+	db = startOnkostarServer(t)
+	exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}, QueryTimeout: time.Nanosecond}, db, nil)
+
+	if _, err := exporter.FetchPatientData(t.Context(), []string{"20000001"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Logf("expected context.DeadlineExceeded, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationExportXlsxConsistentRead(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "export.xlsx")
+	runCommand(t, "--all", "--consistent-read", "export-xlsx", "--filename", filename)
+	assertGolden(t, "export-xlsx.tsv", dumpXlsx(t, filename))
+}
+
+func TestIntegrationConsistentReadShouldNotSeeChanges(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	tx, err := export.BeginConsistentRead(t.Context(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	exporter := export.NewTxExporter(export.Config{MtbTypes: []string{"27"}}, tx, nil)
+	expected, err := exporter.FetchPatientData(t.Context(), []string{"20000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var geschlecht sql.NullString
+	if err := db.QueryRow("SELECT geschlecht FROM patient WHERE patienten_id = '20000001'").Scan(&geschlecht); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE patient SET geschlecht = 'x' WHERE patienten_id = '20000001'"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = db.Exec("UPDATE patient SET geschlecht = ? WHERE patienten_id = '20000001'", geschlecht)
+	}()
+
+	actual, err := exporter.FetchPatientData(t.Context(), []string{"20000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual[0] != expected[0] {
+		t.Logf("data changed within transaction: Expected %v, got %v", expected[0], actual[0])
+		t.Fail()
+	}
+}
+
+func TestIntegrationShouldWriteErrorReport(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "samples.tsv")
+	reportFilename := filepath.Join(t.TempDir(), "report.json")
+	runCommand(t, "--patient-id", "20000001,29999999", "--error-report", reportFilename, "export-samples", "--filename", filename)
+
+	data, err := os.ReadFile(reportFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := ErrorReport{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Complete || report.Command != "export-samples" || len(report.FailedPatients) != 1 || report.FailedPatients[0].PatientID != "29999999" {
+		t.Logf("wrong error report: %s", string(data))
+		t.Fail()
+	}
+	if _, err := os.Stat(filename); err != nil {
+		t.Logf("expected export file without strict mode: %v", err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationStrictShouldExitWithError(t *testing.T) {
+	for _, command := range []string{"export-patients", "export-samples"} {
+		t.Run(command, func(t *testing.T) {
+			dir := os.Getenv("OS2CB_STRICT_TEST_DIR")
+			if len(dir) > 0 {
+				runCommand(t, "--patient-id", "20000001,29999999", "--strict", "--error-report", filepath.Join(dir, "report.json"), command, "--filename", filepath.Join(dir, "output.tsv"))
+				return
+			}
+
+			dir = t.TempDir()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestIntegrationStrictShouldExitWithError$/^"+command+"$")
+			cmd.Env = append(os.Environ(), "OS2CB_STRICT_TEST_DIR="+dir)
+			err := cmd.Run()
+
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+				t.Logf("expected exit code 1, got %v", err)
+				t.Fail()
+			}
+			if _, err := os.Stat(filepath.Join(dir, "output.tsv")); !os.IsNotExist(err) {
+				t.Logf("expected no export file in strict mode: %v", err)
+				t.Fail()
+			}
+			report := &ErrorReport{}
+			if err := json.Unmarshal([]byte(readOutput(t, filepath.Join(dir, "report.json"))), report); err != nil || len(report.FailedPatients) != 1 || report.FailedPatients[0].PatientID != "29999999" {
+				t.Logf("wrong error report in strict mode: %+v (%v)", report, err)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// Leitet Verbindungen über einen Unix-Socket an den Onkostar-Testserver weiter
+func startSocketProxy(t *testing.T) string {
+	t.Helper()
+
+	startOnkostarServer(t)
+	socket := filepath.Join(t.TempDir(), "mysqld.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			target, err := net.Dial("tcp", integrationAddress)
+			if err != nil {
+				_ = conn.Close()
+				continue
+			}
+			go func() {
+				_, _ = io.Copy(target, conn)
+				_ = target.Close()
+			}()
+			go func() {
+				_, _ = io.Copy(conn, target)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return socket
+}
+
+func TestIntegrationShouldConnectWithSocketAndPoolSettings(t *testing.T) {
+	socket := startSocketProxy(t)
+
+	socketDb, err := initDb(mysql.Config{User: "root", Net: "unix", Addr: socket, DBName: "onkostar", AllowNativePasswords: true, ReadTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = socketDb.Close()
+	}()
+	configurePool(socketDb, &CLI{Globals: Globals{MaxOpenConns: 2, ConnMaxLifetime: time.Minute}})
+
+	if socketDb.Stats().MaxOpenConnections != 2 {
+		t.Logf("wrong max open connections: %d", socketDb.Stats().MaxOpenConnections)
+		t.Fail()
+	}
+
+	exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}, Workers: 8, ChunkSize: 5}, socketDb, nil)
+	patientIds, err := exporter.FetchPatientIds(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := exporter.FetchSampleData(t.Context(), patientIds)
+	if err != nil || len(samples) == 0 {
+		t.Logf("cannot fetch samples through socket: %d, %v", len(samples), err)
+		t.Fail()
+	}
+	if socketDb.Stats().OpenConnections > 2 {
+		t.Logf("too many open connections: %d", socketDb.Stats().OpenConnections)
+		t.Fail()
+	}
+}
+
+func TestIntegrationRunJob(t *testing.T) {
+	db = startOnkostarServer(t)
+	dir := t.TempDir()
+
+	vcf := "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tH/2024/1234\n"
+	if err := os.WriteFile(filepath.Join(dir, "sample.vcf"), []byte(vcf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobFile := filepath.Join(dir, "job.yaml")
+	job := `
+patients:
+  filter: all
+options:
+  user: root
+  error_report: ` + filepath.Join(dir, "report.json") + `
+outputs:
+  - type: study
+    dir: study
+    study_id: onkostar_test
+  - type: xlsx
+    file: export.xlsx
+post_steps:
+  - type: anonymize-file
+    input: sample.vcf
+    output: sample.anon.vcf
+`
+	if err := os.WriteFile(jobFile, []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedJob, steps, err := loadJob(jobFile, jobStepParser([]kong.Option{kong.Name("os2cb")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runJob(t.Context(), loadedJob, steps, db); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "export-patients.tsv", readOutput(t, filepath.Join(dir, "study", "data_clinical_patient.txt")))
+	assertGolden(t, "export-samples.tsv", readOutput(t, filepath.Join(dir, "study", "data_clinical_sample.txt")))
+	assertGolden(t, "export-xlsx.tsv", dumpXlsx(t, filepath.Join(dir, "export.xlsx")))
+
+	if meta := readOutput(t, filepath.Join(dir, "study", "meta_clinical_sample.txt")); !strings.Contains(meta, "cancer_study_identifier: onkostar_test") {
+		t.Logf("wrong meta file: %s", meta)
+		t.Fail()
+	}
+	if anonymized := readOutput(t, filepath.Join(dir, "sample.anon.vcf")); !strings.Contains(anonymized, newPseudonymizer(cli).Pseudonymize("H1234-24")) {
+		t.Logf("wrong anonymized file: %s", anonymized)
+		t.Fail()
+	}
+
+	report := &ErrorReport{}
+	if err := json.Unmarshal([]byte(readOutput(t, filepath.Join(dir, "report.json"))), report); err != nil || report.Command != "run" || !report.Complete {
+		t.Logf("wrong error report: %+v (%v)", report, err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationRunJobShouldWriteReportOnStrictError(t *testing.T) {
+	db = startOnkostarServer(t)
+	dir := t.TempDir()
+
+	jobFile := filepath.Join(dir, "job.yaml")
+	job := `
+patients:
+  ids: ["20000001", "29999999"]
+options:
+  user: root
+  strict: "true"
+  error_report: ` + filepath.Join(dir, "report.json") + `
+outputs:
+  - type: patients
+    file: patients.tsv
+  - type: samples
+    file: samples.tsv
+`
+	if err := os.WriteFile(jobFile, []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedJob, steps, err := loadJob(jobFile, jobStepParser([]kong.Option{kong.Name("os2cb")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runJob(t.Context(), loadedJob, steps, db); !errors.Is(err, errIncompleteExport) {
+		t.Logf("expected incomplete export, got %v", err)
+		t.Fail()
+	}
+
+	for _, filename := range []string{"patients.tsv", "samples.tsv"} {
+		if _, err := os.Stat(filepath.Join(dir, filename)); !os.IsNotExist(err) {
+			t.Logf("expected no export file %s in strict mode: %v", filename, err)
+			t.Fail()
+		}
+	}
+
+	report := &ErrorReport{}
+	if err := json.Unmarshal([]byte(readOutput(t, filepath.Join(dir, "report.json"))), report); err != nil || report.Command != "run" || report.Complete || len(report.FailedPatients) != 1 || len(report.Errors) != 0 {
+		t.Logf("wrong error report: %+v (%v)", report, err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationRunJobShouldReturnReportWriteError(t *testing.T) {
+	db = startOnkostarServer(t)
+	dir := t.TempDir()
+
+	jobFile := filepath.Join(dir, "job.yaml")
+	job := `
+patients:
+  ids: ["29999999"]
+options:
+  user: root
+  strict: "true"
+  error_report: ` + filepath.Join(dir, "missing", "report.json") + `
+outputs:
+  - type: samples
+    file: samples.tsv
+`
+	if err := os.WriteFile(jobFile, []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedJob, steps, err := loadJob(jobFile, jobStepParser([]kong.Option{kong.Name("os2cb")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runJob(t.Context(), loadedJob, steps, db); !errors.Is(err, errIncompleteExport) || !strings.Contains(err.Error(), "error-report:") {
+		t.Logf("expected incomplete export and report error, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationRunJobShouldUseOneConsistentRead(t *testing.T) {
+	db = startOnkostarServer(t)
+	dir := t.TempDir()
+
+	jobFile := filepath.Join(dir, "job.yaml")
+	job := `
+patients:
+  filter: all
+options:
+  user: root
+  consistent_read: "true"
+outputs:
+  - type: study
+    dir: study
+`
+	if err := os.WriteFile(jobFile, []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedJob, steps, err := loadJob(jobFile, jobStepParser([]kong.Option{kong.Name("os2cb")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Befehle mit bestehender Transaktion starten keine eigene Transaktion
+	endReadTx, err := beginReadTx(t.Context(), steps[0].cli, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := readTx
+	if endStepTx, err := beginReadTx(t.Context(), steps[1].cli, db); err != nil || readTx != tx {
+		t.Logf("expected existing transaction for step: %v", err)
+		t.Fail()
+	} else {
+		endStepTx()
+	}
+	if readTx != tx {
+		t.Log("existing transaction ended by step")
+		t.Fail()
+	}
+	endReadTx()
+
+	if err := runJob(t.Context(), loadedJob, steps, db); err != nil || readTx != nil {
+		t.Logf("wrong result of job with consistent read: %v, open transaction %v", err, readTx != nil)
+		t.Fail()
+	}
+	assertGolden(t, "export-patients.tsv", readOutput(t, filepath.Join(dir, "study", "data_clinical_patient.txt")))
+	assertGolden(t, "export-samples.tsv", readOutput(t, filepath.Join(dir, "study", "data_clinical_sample.txt")))
+}
+
+func TestIntegrationShouldUsePersStamm(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	// Patient mit gleicher Patienten-ID in einem weiteren Personenstamm
+	if _, err := db.Exec("INSERT INTO patient (id, patienten_id, personenstamm_id, geschlecht) VALUES (999999, '20000001', 5, 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = db.Exec("DELETE FROM patient WHERE id = 999999")
+	}()
+
+	for _, persStamm := range [][]int{{4}, {5}} {
+		exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}, PersStamm: persStamm}, db, nil)
+		patients, err := exporter.FetchPatientData(t.Context(), []string{"20000001"})
+		if err != nil || len(patients) != 1 {
+			t.Logf("wrong patients for pers stamm %v: %v (%v)", persStamm, patients, err)
+			t.Fail()
+			continue
+		}
+		if slices.Equal(persStamm, []int{5}) && patients[0].Sex != "" {
+			t.Logf("wrong patient for pers stamm 5: %v", patients[0])
+			t.Fail()
+		}
+	}
+
+	// Patienten-ID in beiden Personenstämmen wird abgelehnt, andere Patienten werden exportiert
+	exporter := export.NewExporter(export.Config{MtbTypes: []string{"27"}, PersStamm: []int{4, 5}}, db, nil)
+	patients, samples, err := exporter.FetchAll(t.Context(), []string{"20000001", "20000003"})
+	if len(patients) != 1 || patients[0].ID != "20000003" || slices.ContainsFunc(samples, func(sample export.SampleData) bool { return sample.PatientID == "20000001" }) {
+		t.Logf("wrong data for ambiguous patient id: %v %v", patients, samples)
+		t.Fail()
+	}
+	patientErrs := export.PatientErrors(err)
+	if !errors.Is(err, export.ErrAmbiguousPatientID) || len(patientErrs) != 2 || slices.ContainsFunc(patientErrs, func(patientErr *export.PatientError) bool { return patientErr.PatientID != "20000001" }) {
+		t.Logf("wrong error for ambiguous patient id: %v", err)
+		t.Fail()
+	}
+
+	exporter = export.NewExporter(export.Config{MtbTypes: []string{"27"}, PersStamm: []int{5}}, db, nil)
+	if patientIds, err := exporter.FetchPatientIds(t.Context()); err != nil || len(patientIds) != 0 {
+		t.Logf("wrong patient ids for pers stamm 5: %v (%v)", patientIds, err)
+		t.Fail()
+	}
+	if samples, err := exporter.FetchSampleData(t.Context(), []string{"20000001"}); err != nil || len(samples) != 0 {
+		t.Logf("wrong samples for pers stamm 5: %v (%v)", samples, err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationShouldUseMtbTypes(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	patientIds, err := export.NewExporter(export.Config{}, db, nil).FetchPatientIds(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := export.NewExporter(export.Config{}, db, nil).FetchPatientData(t.Context(), patientIds)
+
+	actual, _ := export.NewExporter(export.Config{MtbTypes: []string{"99", "27"}}, db, nil).FetchPatientData(t.Context(), patientIds)
+	if !slices.Equal(actual, expected) {
+		t.Log("wrong patient data for several MTB types")
+		t.Fail()
+	}
+
+	unknown, _ := export.NewExporter(export.Config{MtbTypes: []string{"99"}}, db, nil).FetchPatientData(t.Context(), patientIds)
+	for _, patient := range unknown {
+		if patient.Icd10Code != "" || patient.MtbEcogStatus != "NA" || patient.XFirstMtbYear != "" {
+			t.Logf("unexpected MTB data for unknown MTB type: %v", patient)
+			t.Fail()
+		}
+	}
+}
+
+func TestIntegrationMtbTypes(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	out := bytes.Buffer{}
+	if err := printMtbTypes(t.Context(), &out, &CLI{}, db); err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "mtb-types.tsv", out.String())
+}
+
+func TestIntegrationExportSamplesWithDateRange(t *testing.T) {
+	for _, dateField := range []string{"sequencing", "mtb", "diagnosis"} {
+		t.Run(dateField, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "samples.tsv")
+			runCommand(t, "--all", "--from", "2022-01-01", "--to", "2024-12-31", "--date-field", dateField, "export-samples", "--filename", filename)
+			assertGolden(t, "export-samples-"+dateField+"-2022-2024.tsv", readOutput(t, filename))
+		})
+	}
+}
+
+func TestIntegrationExportSamplesWithDiagnoses(t *testing.T) {
+	testsArgs := []struct {
+		golden string
+		args   []string
+	}{
+		{"export-samples-ocaplus-c34.tsv", []string{"--oca-plus", "--icd10", "C34"}},
+		{"export-samples-8140.tsv", []string{"--all", "--morphology", "8140"}},
+		{"export-samples-c18-c25-8140.tsv", []string{"--all", "--icd10", "C18,C25", "--morphology", "8140/3"}},
+	}
+
+	for _, tt := range testsArgs {
+		t.Run(tt.golden, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "samples.tsv")
+			runCommand(t, append(tt.args, "export-samples", "--filename", filename)...)
+			assertGolden(t, tt.golden, readOutput(t, filename))
+		})
+	}
+}
+
+func TestIntegrationFetchPatientIdsWithDiagnoses(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	all, err := export.NewExporter(export.Config{}, db, nil).FetchPatientIds(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := export.NewExporter(export.Config{Icd10: []string{"C34"}}, db, nil).FetchPatientIds(t.Context())
+	if err != nil || len(actual) == 0 || len(actual) >= len(all) {
+		t.Logf("wrong patient ids for icd10: %d of %d (%v)", len(actual), len(all), err)
+		t.Fail()
+	}
+
+	actual, err = export.NewExporter(export.Config{Icd10: []string{"C34_"}}, db, nil).FetchPatientIds(t.Context())
+	if err != nil || len(actual) != 0 {
+		t.Logf("expected no patient ids for escaped prefix: %v (%v)", actual, err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationFetchPatientIdsWithDateRange(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	all, err := export.NewExporter(export.Config{}, db, nil).FetchPatientIds(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, dateField := range []export.DateField{export.SequencingDate, export.MtbDate, export.DiagnosisDate} {
+		exporter := export.NewExporter(export.Config{DateRange: export.DateRange{Field: dateField, From: from}}, db, nil)
+		actual, err := exporter.FetchPatientIds(t.Context())
+		if err != nil || len(actual) == 0 || len(actual) >= len(all) {
+			t.Logf("wrong patient ids for date field %d: %d of %d (%v)", dateField, len(actual), len(all), err)
+			t.Fail()
+		}
+		for _, patientID := range actual {
+			if !slices.Contains(all, patientID) {
+				t.Logf("unexpected patient id for date field %d: %s", dateField, patientID)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestIntegrationShouldIncludeTimeOfDayOnLastDayOfDateRange(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	var prozedurID, patientID, datum string
+	if err := db.QueryRow(`SELECT dm.id, pat.patienten_id, DATE_FORMAT(dm.datum, '%Y-%m-%d') FROM dk_molekulargenetik dm
+		JOIN prozedur ON prozedur.id = dm.id JOIN patient pat ON pat.id = prozedur.patient_id
+		WHERE dm.datum IS NOT NULL AND prozedur.geloescht = 0 ORDER BY dm.id LIMIT 1`).Scan(&prozedurID, &patientID, &datum); err != nil {
+		t.Fatal(err)
+	}
+
+	// Untersuchung mit Uhrzeit am letzten Tag des Zeitraums
+	if _, err := db.Exec("ALTER TABLE dk_molekulargenetik MODIFY COLUMN datum DATETIME"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = db.Exec("UPDATE dk_molekulargenetik SET datum = ? WHERE id = ?", datum, prozedurID)
+		_, _ = db.Exec("ALTER TABLE dk_molekulargenetik MODIFY COLUMN datum DATE")
+	}()
+	if _, err := db.Exec("UPDATE dk_molekulargenetik SET datum = ? WHERE id = ?", datum+" 15:30:00", prozedurID); err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := time.Parse(time.DateOnly, datum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := export.NewSQLSource(db, 0)
+	snapshot, err := export.NewSnapshot(t.Context(), source, export.Config{}, []string{patientID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		to       time.Time
+		expected bool
+	}{
+		{to, true},
+		{to.AddDate(0, 0, -1), false},
+	} {
+		selection := export.Selection{DateRange: export.DateRange{Field: export.SequencingDate, To: tt.to}}
+		for name, source := range map[string]export.OnkostarSource{"sql": source, "memory": snapshot} {
+			procedures, err := source.MolecularProcedures(t.Context(), []string{patientID}, selection)
+			found := slices.ContainsFunc(procedures[patientID], func(record export.MolecularRecord) bool { return record.ProzedurID == prozedurID })
+			if err != nil || found != tt.expected {
+				t.Logf("wrong result for %s source up to %s: %v (%v)", name, tt.to.Format(time.DateOnly), found, err)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestIntegrationShouldRefuseFakeOnkostarInNonEmptyDatabase(t *testing.T) {
+	db = startOnkostarServer(t)
+
+	if err := CheckEmptyOnkostar(db); err == nil {
+		t.Log("expected error for database with patients")
+		t.Fail()
+	}
+
+	if _, err := db.Exec("CREATE DATABASE synthetic"); err != nil {
+		t.Fatal(err)
+	}
+	emptyDb, err := initDb(mysql.Config{User: "root", Net: "tcp", Addr: integrationAddress, DBName: "synthetic", AllowNativePasswords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = emptyDb.Close()
+	}()
+
+	if err := CheckEmptyOnkostar(emptyDb); err != nil {
+		t.Logf("unexpected error for empty database: %v", err)
+		t.Fail()
+	}
+}
+
+func TestIntegrationShouldFetchBiomarkersInChunks(t *testing.T) {
+	db = startOnkostarServer(t)
+	source := export.NewSQLSource(db, 0)
+
+	patientIds, err := source.PatientIds(t.Context(), export.Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	procedures, err := source.MolecularProcedures(t.Context(), patientIds, export.Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prozedurIds []string
+	for _, records := range procedures {
+		for _, record := range records {
+			prozedurIds = append(prozedurIds, record.ProzedurID)
+		}
+	}
+
+	expected, err := source.Biomarkers(t.Context(), prozedurIds)
+	if err != nil || len(expected) == 0 {
+		t.Fatalf("cannot fetch biomarkers: %v", err)
+	}
+
+	// Nicht vorhandene Prozedur-IDs verteilen die Untersuchungen auf mehrere Abfragen
+	var manyIds []string
+	for i, prozedurID := range prozedurIds {
+		manyIds = append(manyIds, prozedurID)
+		for j := range export.DefaultChunkSize / 10 {
+			manyIds = append(manyIds, fmt.Sprintf("-%d", i*export.DefaultChunkSize+j+1))
+		}
+	}
+	actual, err := source.Biomarkers(t.Context(), manyIds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJson, _ := json.Marshal(expected)
+	actualJson, _ := json.Marshal(actual)
+	if !bytes.Equal(expectedJson, actualJson) {
+		t.Logf("wrong biomarkers for %d procedure ids: Expected %s, got %s", len(manyIds), expectedJson, actualJson)
+		t.Fail()
+	}
+
+	// Mit konfigurierter Anzahl je Abfrage
+	actual, err = export.NewSQLSource(db, 0).WithChunkSize(2).Biomarkers(t.Context(), prozedurIds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualJson, _ = json.Marshal(actual)
+	if !bytes.Equal(expectedJson, actualJson) {
+		t.Logf("wrong biomarkers for chunk size 2: Expected %s, got %s", expectedJson, actualJson)
+		t.Fail()
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/gocarina/gocsv"
+	"gopkg.in/yaml.v3"
+
+	"os2cb/export"
+)
+
+// Ausführung eines Export-Jobs aus einer YAML-Datei
+type RunCmd struct {
+	Job   string `arg:"" help:"YAML-Datei mit Beschreibung des Export-Jobs" type:"existingfile"`
+	Check bool   `help:"Job-Datei nur prüfen, nicht ausführen"`
+}
+
+// Datenbankbenutzer und Patienten werden in der Job-Datei angegeben
+func (cmd *RunCmd) BeforeApply(kctx *kong.Context) error {
+	for _, flag := range kctx.Flags() {
+		flag.Required = false
+	}
+	return nil
+}
+
+// Export-Job mit Verbindungsprofil, Patientenauswahl, Anonymisierung, Ausgaben und nachfolgenden Schritten
+type Job struct {
+	Profile       string            `yaml:"profile"`
+	Patients      JobPatients       `yaml:"patients"`
+	Anonymization JobAnonymization  `yaml:"anonymization"`
+	Options       map[string]string `yaml:"options"`
+	Outputs       []JobOutput       `yaml:"outputs"`
+	PostSteps     []JobPostStep     `yaml:"post_steps"`
+}
+
+// Auswahl der Patienten, entweder über IDs, eine Datei mit IDs oder einen Filter
+type JobPatients struct {
+	IDs        []string `yaml:"ids"`
+	File       string   `yaml:"file"`
+	Filter     string   `yaml:"filter"`
+	PersStamm  []int    `yaml:"pers_stamm"`
+	From       string   `yaml:"from"`
+	To         string   `yaml:"to"`
+	DateField  string   `yaml:"date_field"`
+	Icd10      []string `yaml:"icd10"`
+	Morphology []string `yaml:"morphology"`
+}
+
+// Einstellungen zur Anonymisierung. Ohne Angabe wird anonymisiert.
+type JobAnonymization struct {
+	Enabled  *bool  `yaml:"enabled"`
+	IDPrefix string `yaml:"id_prefix"`
+}
+
+// Prüft, ob anonymisiert wird
+func (anonymization JobAnonymization) enabled() bool {
+	return anonymization.Enabled == nil || *anonymization.Enabled
+}
+
+// Pseudonymisierung für nachfolgende Schritte. Ohne Präfix in der Job-Datei wird wie bei den Befehlen der
+// angegebene Präfix aus Profil, Konfigurationsdatei oder Standardwert verwendet.
+func (anonymization JobAnonymization) pseudonymizer(defaultPrefix string) export.Pseudonymizer {
+	if len(anonymization.IDPrefix) > 0 {
+		return export.HashPseudonymizer{Prefix: anonymization.IDPrefix}
+	}
+	return export.HashPseudonymizer{Prefix: defaultPrefix}
+}
+
+// Ausgabe eines Export-Jobs
+type JobOutput struct {
+	Type    string `yaml:"type"`
+	File    string `yaml:"file"`
+	Format  string `yaml:"format"`
+	Dir     string `yaml:"dir"`
+	StudyID string `yaml:"study_id"`
+}
+
+// Nachfolgender Schritt eines Export-Jobs
+type JobPostStep struct {
+	Type   string `yaml:"type"`
+	Input  string `yaml:"input"`
+	Output string `yaml:"output"`
+	Format string `yaml:"format"`
+}
+
+// Einzelner Befehl eines Export-Jobs mit den zugehörigen Kommandozeilenparametern
+type JobStep struct {
+	Args    []string
+	cli     *CLI
+	context *kong.Context
+}
+
+var jobFilters = map[string]string{"all": "--all", "oca-plus": "--oca-plus", "wes": "--wes", "wgs": "--wgs"}
+
+// Parameter, die nicht in 'options' angegeben werden dürfen, da sie eigene Angaben in der Job-Datei haben oder
+// für einen Job nicht sinnvoll sind. Passwörter sollen nicht in der Job-Datei stehen.
+var jobReservedOptions = []string{
+	"profile", "password", "save-db-config", "no-anon", "id-prefix",
+	"patient-id", "from-std-in", "oca-plus", "wes", "wgs", "all", "pers-stamm", "from", "to", "date-field",
+	"icd10", "morphology",
+}
+
+// Liest und prüft die Job-Datei
+func loadJob(filename string, parse func(args []string) (*CLI, *kong.Context, error)) (*Job, []JobStep, error) {
+	job, err := ReadJob(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	steps, err := job.Steps(parse)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, steps, nil
+}
+
+// Parst die Kommandozeilenparameter eines Befehls mit eigenem Parser, wie beim Aufruf der Anwendung
+func jobStepParser(options []kong.Option) func(args []string) (*CLI, *kong.Context, error) {
+	return func(args []string) (*CLI, *kong.Context, error) {
+		stepCli := &CLI{}
+		parser, err := kong.New(stepCli, options...)
+		if err != nil {
+			return nil, nil, err
+		}
+		kctx, err := parser.Parse(args)
+		return stepCli, kctx, err
+	}
+}
+
+// Liest die Job-Datei. Unbekannte Felder führen zu einem Fehler.
+func ReadJob(filename string) (*Job, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("job: Datei kann nicht gelesen werden: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	job := &Job{}
+	if err := decoder.Decode(job); err != nil {
+		return nil, fmt.Errorf("job: Ungültige Job-Datei '%s': %w", filename, err)
+	}
+	job.resolvePaths(filepath.Dir(filename))
+	return job, nil
+}
+
+// Relative Pfade beziehen sich auf das Verzeichnis der Job-Datei
+func (job *Job) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if len(*path) > 0 && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	resolve(&job.Patients.File)
+	for i := range job.Outputs {
+		resolve(&job.Outputs[i].File)
+		resolve(&job.Outputs[i].Dir)
+	}
+	for i := range job.PostSteps {
+		resolve(&job.PostSteps[i].Input)
+		resolve(&job.PostSteps[i].Output)
+	}
+}
+
+// Prüft den Job und erstellt die auszuführenden Befehle. Alle Fehler werden gemeinsam zurückgegeben.
+func (job *Job) Steps(parse func(args []string) (*CLI, *kong.Context, error)) ([]JobStep, error) {
+	var errs []error
+
+	baseArgs, err := job.baseArgs()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(job.Outputs) == 0 {
+		errs = append(errs, errors.New("job: Keine Ausgaben angegeben"))
+	}
+
+	var steps []JobStep
+	for i, output := range job.Outputs {
+		commands, err := output.commands()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job: outputs[%d]: %w", i, err))
+			continue
+		}
+		for _, command := range commands {
+			steps = append(steps, JobStep{Args: append(slices.Clone(baseArgs), command...)})
+		}
+	}
+
+	for i, step := range job.PostSteps {
+		if err := step.validate(job.Anonymization); err != nil {
+			errs = append(errs, fmt.Errorf("job: post_steps[%d]: %w", i, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	for i := range steps {
+		if steps[i].cli, steps[i].context, err = parse(steps[i].Args); err != nil {
+			errs = append(errs, fmt.Errorf("job: %s: %w", strings.Join(steps[i].Args, " "), err))
+		}
+	}
+	return steps, errors.Join(errs...)
+}
+
+// Gemeinsame Parameter aller Befehle
+func (job *Job) baseArgs() ([]string, error) {
+	var args []string
+	if len(job.Profile) > 0 {
+		args = append(args, "--profile", job.Profile)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(job.Options)) {
+		flagName := strings.ReplaceAll(key, "_", "-")
+		if slices.Contains(jobReservedOptions, flagName) {
+			return nil, fmt.Errorf("job: options: '%s' nicht erlaubt", key)
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", flagName, job.Options[key]))
+	}
+
+	if job.Anonymization.Enabled != nil && !*job.Anonymization.Enabled {
+		args = append(args, "--no-anon")
+	}
+	if len(job.Anonymization.IDPrefix) > 0 {
+		args = append(args, "--id-prefix", job.Anonymization.IDPrefix)
+	}
+
+	patients := job.Patients
+	if len(patients.PersStamm) > 0 {
+		var persStamm []string
+		for _, id := range patients.PersStamm {
+			persStamm = append(persStamm, strconv.Itoa(id))
+		}
+		args = append(args, "--pers-stamm", strings.Join(persStamm, ","))
+	}
+
+	if len(patients.From) > 0 {
+		args = append(args, "--from", patients.From)
+	}
+	if len(patients.To) > 0 {
+		args = append(args, "--to", patients.To)
+	}
+	if len(patients.DateField) > 0 {
+		args = append(args, "--date-field", patients.DateField)
+	}
+	if len(patients.Icd10) > 0 {
+		args = append(args, "--icd10", strings.Join(patients.Icd10, ","))
+	}
+	if len(patients.Morphology) > 0 {
+		args = append(args, "--morphology", strings.Join(patients.Morphology, ","))
+	}
+
+	selections := 0
+	if len(patients.IDs) > 0 {
+		selections++
+		args = append(args, "--patient-id", strings.Join(patients.IDs, ","))
+	}
+	if len(patients.File) > 0 {
+		selections++
+		ids, err := readPatientIds(patients.File)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--patient-id", strings.Join(ids, ","))
+	}
+	if len(patients.Filter) > 0 {
+		selections++
+		filter, ok := jobFilters[patients.Filter]
+		if !ok {
+			return nil, fmt.Errorf("job: patients: Unbekannter Filter '%s' ('all', 'oca-plus', 'wes', 'wgs')", patients.Filter)
+		}
+		args = append(args, filter)
+	}
+	if selections != 1 {
+		return nil, errors.New("job: patients: Genau eine Angabe von 'ids', 'file' oder 'filter' erforderlich")
+	}
+
+	return args, nil
+}
+
+// Liest Patienten-IDs aus einer Datei, getrennt durch Komma, Semikolon, Tabulator oder Zeilenumbruch
+func readPatientIds(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("job: patients: Datei kann nicht gelesen werden: %w", err)
+	}
+	splitRegEx := regexp.MustCompile("\\s*[,;\t\r\n]+\\s*")
+	ids := splitRegEx.Split(strings.TrimSpace(string(data)), -1)
+	if len(ids) == 0 || len(ids[0]) == 0 {
+		return nil, fmt.Errorf("job: patients: Keine Patienten-IDs in '%s'", filename)
+	}
+	return ids, nil
+}
+
+// Befehle zur Erzeugung der Ausgabe
+func (output JobOutput) commands() ([][]string, error) {
+	switch output.Type {
+	case "patients", "samples":
+		if len(output.File) == 0 {
+			return nil, errors.New("'file' erforderlich")
+		}
+		command := []string{"export-" + output.Type, "--filename", output.File}
+		switch output.Format {
+		case "", "tsv":
+		case "csv":
+			command = append(command, "--csv")
+		default:
+			return nil, fmt.Errorf("Unbekanntes Format '%s' ('tsv', 'csv')", output.Format)
+		}
+		return [][]string{command}, nil
+	case "xlsx":
+		if !strings.HasSuffix(output.File, ".xlsx") {
+			return nil, errors.New("'file' mit Endung '.xlsx' erforderlich")
+		}
+		if len(output.Format) > 0 {
+			return nil, errors.New("'format' wird für 'xlsx' nicht unterstützt")
+		}
+		return [][]string{{"export-xlsx", "--filename", output.File}}, nil
+	case "study":
+		if len(output.Dir) == 0 {
+			return nil, errors.New("'dir' erforderlich")
+		}
+		return [][]string{
+			{"export-patients", "--filename", filepath.Join(output.Dir, "data_clinical_patient.txt")},
+			{"export-samples", "--filename", filepath.Join(output.Dir, "data_clinical_sample.txt")},
+		}, nil
+	}
+	return nil, fmt.Errorf("Unbekannter Typ '%s' ('patients', 'samples', 'xlsx', 'study')", output.Type)
+}
+
+func (step JobPostStep) validate(anonymization JobAnonymization) error {
+	if step.Type != "anonymize-file" {
+		return fmt.Errorf("Unbekannter Typ '%s' ('anonymize-file')", step.Type)
+	}
+	if !anonymization.enabled() {
+		return errors.New("'anonymize-file' nicht möglich, da die Anonymisierung deaktiviert ist")
+	}
+	if len(step.Input) == 0 || len(step.Output) == 0 {
+		return errors.New("'input' und 'output' erforderlich")
+	}
+	if !slices.Contains([]string{"", "auto", VcfFormat, SegFormat, MafFormat}, step.Format) {
+		return fmt.Errorf("Unbekanntes Format '%s' ('auto', 'vcf', 'seg', 'maf')", step.Format)
+	}
+	return nil
+}
+
+// Schreibt die Metadaten einer cBioPortal-Studie zu den klinischen Daten
+func writeStudyMetaFiles(output JobOutput) error {
+	if len(output.StudyID) == 0 {
+		return nil
+	}
+	for _, meta := range []struct{ datatype, name string }{{"PATIENT_ATTRIBUTES", "patient"}, {"SAMPLE_ATTRIBUTES", "sample"}} {
+		content := fmt.Sprintf("cancer_study_identifier: %s\ngenetic_alteration_type: CLINICAL\ndatatype: %s\ndata_filename: data_clinical_%s.txt\n", output.StudyID, meta.datatype, meta.name)
+		if err := os.WriteFile(filepath.Join(output.Dir, "meta_clinical_"+meta.name+".txt"), []byte(content), 0644); err != nil {
+			return fmt.Errorf("job: Metadaten können nicht geschrieben werden: %w", err)
+		}
+	}
+	return nil
+}
+
+// Führt alle Befehle und nachfolgenden Schritte des Jobs mit bestehender Datenbankverbindung aus.
+// Fehlerberichte der einzelnen Befehle werden zusammengefasst. Bei einem Fehler wird der Job abgebrochen,
+// der Fehlerbericht enthält dann auch die Fehler aller vorherigen Befehle.
+func runJob(ctx context.Context, job *Job, steps []JobStep, db *sql.DB) error {
+	jobReport := NewErrorReport("run")
+	reportFilename := steps[0].cli.ErrorReport
+
+	fail := func(err error) error {
+		addCommandError(jobReport, err)
+		if len(reportFilename) > 0 {
+			return errors.Join(err, jobReport.Write(reportFilename))
+		}
+		return err
+	}
+
+	// Alle Befehle des Jobs verwenden mit 'consistent_read' dieselbe Transaktion und damit denselben Datenstand
+	endReadTx, err := beginReadTx(ctx, steps[0].cli, db)
+	if err != nil {
+		return fail(err)
+	}
+	defer endReadTx()
+
+	for _, output := range job.Outputs {
+		if output.Type == "study" {
+			if err := os.MkdirAll(output.Dir, 0755); err != nil {
+				return fail(fmt.Errorf("job: Verzeichnis kann nicht erstellt werden: %w", err))
+			}
+		}
+	}
+
+	for _, step := range steps {
+		log.Printf("Ausführen: %s\n", strings.Join(step.Args, " "))
+		cli, kongContext = step.cli, step.context
+		gocsv.SetCSVWriter(getCsvWriter(cli.ExportPatients.Csv || cli.ExportSamples.Csv))
+		gocsv.SetCSVReader(getCsvReader(cli.ExportPatients.Csv || cli.ExportSamples.Csv))
+		err := executeCommand(ctx, cli, db)
+		jobReport.Merge(exportReport)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	for _, output := range job.Outputs {
+		if output.Type == "study" {
+			if err := writeStudyMetaFiles(output); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	pseudonymizer := job.Anonymization.pseudonymizer(steps[0].cli.IDPrefix)
+	for _, step := range job.PostSteps {
+		log.Printf("Ausführen: %s %s -> %s\n", step.Type, step.Input, step.Output)
+		if err := AnonymizeFile(step.Input, step.Output, step.Format, pseudonymizer); err != nil {
+			return fail(err)
+		}
+	}
+
+	if len(reportFilename) > 0 {
+		return jobReport.Write(reportFilename)
+	}
+	return nil
+}
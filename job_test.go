@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+func writeJobFile(t *testing.T, content string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "job.yaml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestShouldCreateJobSteps(t *testing.T) {
+	filename := writeJobFile(t, `
+patients:
+  ids: ["20000001", "20000003"]
+anonymization:
+  id_prefix: TEST
+options:
+  user: root
+  chunk_size: "2"
+outputs:
+  - type: patients
+    file: patients.csv
+    format: csv
+  - type: study
+    dir: study
+`)
+	dir := filepath.Dir(filename)
+
+	_, steps, err := loadJob(filename, jobStepParser([]kong.Option{kong.Name("os2cb")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"--chunk-size=2", "--user=root", "--id-prefix", "TEST", "--patient-id", "20000001,20000003", "export-patients", "--filename", filepath.Join(dir, "patients.csv"), "--csv"},
+		{"--chunk-size=2", "--user=root", "--id-prefix", "TEST", "--patient-id", "20000001,20000003", "export-patients", "--filename", filepath.Join(dir, "study", "data_clinical_patient.txt")},
+		{"--chunk-size=2", "--user=root", "--id-prefix", "TEST", "--patient-id", "20000001,20000003", "export-samples", "--filename", filepath.Join(dir, "study", "data_clinical_sample.txt")},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("wrong number of steps: Expected %d, got %d", len(expected), len(steps))
+	}
+	for i, step := range steps {
+		if !slices.Equal(step.Args, expected[i]) {
+			t.Logf("wrong args: Expected %v, got %v", expected[i], step.Args)
+			t.Fail()
+		}
+	}
+	if steps[0].cli.ChunkSize != 2 || !steps[0].cli.ExportPatients.Csv || steps[2].context.Command() != "export-samples" {
+		t.Logf("wrong parsed parameters: %+v", steps[0].cli.Globals)
+		t.Fail()
+	}
+}
+
+func TestShouldReportAllJobErrors(t *testing.T) {
+	filename := writeJobFile(t, `
+patients:
+  filter: lung
+options:
+  password: geheim
+outputs:
+  - type: xlsx
+    file: export.xls
+  - type: vcf
+post_steps:
+  - type: anonymize-file
+    input: sample.vcf
+    output: sample.anon.vcf
+    format: bam
+`)
+
+	_, _, err := loadJob(filename, jobStepParser([]kong.Option{kong.Name("os2cb")}))
+	if err == nil {
+		t.Fatal("expected error for invalid job")
+	}
+	for _, expected := range []string{"job: options: 'password'", "job: outputs[0]", "job: outputs[1]", "job: post_steps[0]"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Logf("missing error '%s' in: %s", expected, err.Error())
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldRejectUnknownJobFields(t *testing.T) {
+	filename := writeJobFile(t, `
+patients:
+  all: true
+outputs:
+  - type: patients
+    file: patients.tsv
+`)
+
+	if _, err := ReadJob(filename); err == nil {
+		t.Log("expected error for unknown field")
+		t.Fail()
+	}
+}
+
+func TestShouldRequireSinglePatientSelection(t *testing.T) {
+	filename := writeJobFile(t, `
+patients:
+  ids: ["20000001"]
+  filter: all
+options:
+  user: root
+outputs:
+  - type: patients
+    file: patients.tsv
+`)
+
+	if _, _, err := loadJob(filename, jobStepParser([]kong.Option{kong.Name("os2cb")})); err == nil || !strings.Contains(err.Error(), "job: patients") {
+		t.Logf("expected error for multiple patient selections, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestShouldFailJobStepWithoutUser(t *testing.T) {
+	filename := writeJobFile(t, `
+patients:
+  filter: all
+outputs:
+  - type: samples
+    file: samples.tsv
+`)
+
+	if _, _, err := loadJob(filename, jobStepParser([]kong.Option{kong.Name("os2cb")})); err == nil {
+		t.Log("expected error for missing user")
+		t.Fail()
+	}
+}
+
+func TestShouldRejectAnonymizeFileWithoutAnonymization(t *testing.T) {
+	filename := writeJobFile(t, `
+patients:
+  filter: all
+anonymization:
+  enabled: false
+options:
+  user: root
+outputs:
+  - type: samples
+    file: samples.tsv
+post_steps:
+  - type: anonymize-file
+    input: sample.vcf
+    output: sample.anon.vcf
+`)
+
+	if _, _, err := loadJob(filename, jobStepParser([]kong.Option{kong.Name("os2cb")})); err == nil || !strings.Contains(err.Error(), "job: post_steps[0]") {
+		t.Logf("expected error for anonymize-file without anonymization, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestShouldUseJobIDPrefixForPostSteps(t *testing.T) {
+	anonymization := JobAnonymization{IDPrefix: "JOB"}
+	if actual := anonymization.pseudonymizer("WUE").Pseudonymize("H1234-24"); !strings.HasPrefix(actual, "JOB_") {
+		t.Logf("wrong prefix: %s", actual)
+		t.Fail()
+	}
+	if actual := (JobAnonymization{}).pseudonymizer("WUE").Pseudonymize("H1234-24"); !strings.HasPrefix(actual, "WUE_") {
+		t.Logf("wrong default prefix: %s", actual)
+		t.Fail()
+	}
+}
+
+func TestShouldMergeErrorReports(t *testing.T) {
+	report := NewErrorReport("run")
+	other := NewErrorReport("export-samples")
+	other.AddRetried([]string{"20000001"})
+	other.Complete = false
+	other.Errors = append(other.Errors, "Fehler")
+
+	report.Merge(other)
+
+	if report.Complete || len(report.Errors) != 1 || len(report.RetriedPatients) != 1 {
+		t.Logf("wrong report: %+v", report)
+		t.Fail()
+	}
+}
@@ -1,59 +1,103 @@
 package main
 
 import (
-	"crypto/sha256"
+	"context"
 	"database/sql"
 	"encoding/csv"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
 	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/go-sql-driver/mysql"
 	"github.com/gocarina/gocsv"
-	"golang.org/x/term"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 
+	"os2cb/export"
+
 	_ "syscall"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 var (
-	cli     *CLI
-	context *kong.Context
-	db      *sql.DB
+	cli         *CLI
+	kongContext *kong.Context
+	db          *sql.DB
+	// Lesende Transaktion für einheitlichen Datenstand bei Verwendung von '--consistent-read'
+	readTx *sql.Tx
+	// Fehlerbericht des aktuellen Exports
+	exportReport *ErrorReport
 )
 
 type Globals struct {
-	User         string `short:"U" help:"Database username" required:"NA"`
-	Password     string `short:"P" help:"Database password"`
-	Host         string `short:"H" help:"Database host" default:"localhost"`
-	Port         int    `help:"Database port" default:"3306"`
-	Ssl          string `help:"SSL-Verbindung ('true', 'false', 'skip-verify', 'preferred')" default:"false"`
-	Database     string `short:"D" help:"Database name" default:"onkostar"`
-	IDPrefix     string `help:"Zu verwendender Prefix für anonymisierte IDs. 'WUE', wenn nicht anders angegeben." default:"WUE"`
-	AllTk        bool   `help:"Diagnosen: Erlaube Diagnosen mit allen Tumorkonferenzen, nicht nur Diagnosen mit MTBs"`
-	MtbType      string `help:"MTB-Typ der Tumorkonferenz in Onkostar. Wenn nicht angegeben, Wert: '27'" default:"27"`
-	NoAnon       bool   `help:"Keine ID-Anonymisierung anwenden. Hierbei wird auch das ID-Prefix ignoriert."`
-	SaveDbConfig bool   `help:"Save database username, host, port and database name to config file" default:"false"`
+	Profile         string        `help:"Verbindungsprofil aus der Konfigurationsdatei verwenden, siehe 'config'"`
+	User            string        `short:"U" help:"Database username" required:"NA"`
+	Password        string        `short:"P" help:"Database password" env:"OS2CB_PASSWORD"`
+	PasswordFile    string        `help:"Datei mit Passwort in erster Zeile. Die Datei darf nur für den Besitzer lesbar sein" type:"path"`
+	Keyring         bool          `help:"Passwort im Schlüsselbund des Betriebssystems verwenden. Mit '--save-db-config' wird das Passwort dort gespeichert"`
+	Host            string        `short:"H" help:"Database host" default:"localhost"`
+	Port            int           `help:"Database port" default:"3306"`
+	Socket          string        `help:"Verbindung über Unix-Socket anstelle von Host und Port, z.B. '/var/run/mysqld/mysqld.sock'" type:"path" xor:"Socket,SshHost"`
+	Ssl             string        `help:"SSL-Verbindung ('true', 'false', 'skip-verify', 'preferred')" default:"false"`
+	SslCa           string        `help:"CA-Zertifikat(e) im PEM-Format zur Prüfung des Datenbankservers" type:"path"`
+	SslCert         string        `help:"Client-Zertifikat im PEM-Format" type:"path"`
+	SslKey          string        `help:"Schlüssel des Client-Zertifikats im PEM-Format" type:"path"`
+	SslServerName   string        `help:"Servername zur Prüfung des Zertifikats, wenn abweichend vom Host"`
+	SshHost         string        `help:"SSH-Tunnel: Jump-Host, über den die Datenbank erreicht wird, z.B. 'jump.example.org:22'" xor:"Socket,SshHost"`
+	SshUser         string        `help:"SSH-Tunnel: Benutzername auf dem Jump-Host"`
+	SshKey          string        `help:"SSH-Tunnel: Private Schlüsseldatei" type:"path"`
+	SshKnownHosts   string        `help:"SSH-Tunnel: known_hosts-Datei zur Prüfung des Jump-Hosts. Standard: '~/.ssh/known_hosts'" type:"path"`
+	Database        string        `short:"D" help:"Database name" default:"onkostar"`
+	MaxOpenConns    int           `help:"Maximale Anzahl gleichzeitiger Datenbankverbindungen. Ohne Angabe unbegrenzt"`
+	ConnMaxLifetime time.Duration `help:"Maximale Dauer, die eine Datenbankverbindung wiederverwendet wird, z.B. '5m'. Ohne Angabe unbegrenzt"`
+	ReadTimeout     time.Duration `help:"Maximale Wartezeit beim Lesen von der Datenbankverbindung, z.B. '30s'. Ohne Angabe unbegrenzt"`
+	IDPrefix        string        `help:"Zu verwendender Prefix für anonymisierte IDs. 'WUE', wenn nicht anders angegeben." default:"WUE"`
+	AllTk           bool          `help:"Diagnosen: Erlaube Diagnosen mit allen Tumorkonferenzen, nicht nur Diagnosen mit MTBs"`
+	MtbType         []string      `help:"MTB-Typ der Tumorkonferenz in Onkostar, kommagetrennt bei mehreren Typen. Wenn nicht angegeben, Wert: '27'. Siehe 'mtb-types'" default:"27"`
+	NoAnon          bool          `help:"Keine ID-Anonymisierung anwenden. Hierbei wird auch das ID-Prefix ignoriert."`
+	ChunkSize       int           `help:"Anzahl Patienten-IDs je Datenbankabfrage" default:"500"`
+	Workers         int           `help:"Anzahl paralleler Datenbankabfragen" default:"4"`
+	Timeout         time.Duration `help:"Maximale Dauer des Exports, z.B. '30m'. Ohne Angabe unbegrenzt"`
+	QueryTimeout    time.Duration `help:"Maximale Dauer einer Datenbankabfrage, z.B. '60s'. Ohne Angabe unbegrenzt"`
+	Retries         int           `help:"Anzahl Wiederholungen einer Datenbankabfrage bei Verbindungsabbruch oder Lock-Timeout. Nicht mit '--consistent-read'" default:"3"`
+	RetryDelay      time.Duration `help:"Wartezeit vor der ersten Wiederholung, verdoppelt sich mit jeder weiteren" default:"500ms"`
+	Strict          bool          `help:"Bei Fehlern zu einzelnen Patienten keine Datei schreiben und mit Exit-Code 1 beenden"`
+	ErrorReport     string        `help:"Fehlerbericht mit allen fehlerhaften Patienten als JSON-Datei schreiben" type:"path"`
+	ConsistentRead  bool          `help:"Alle Abfragen in einer lesenden Transaktion (REPEATABLE READ) mit einheitlichem Datenstand ausführen. Abfragen erfolgen dann nacheinander"`
+	SaveDbConfig    bool          `help:"Save database username, host, port and database name to config file" default:"false"`
 }
 
 type PatientSelection struct {
-	PatientID []string `help:"PatientenIDs der zu exportierenden Patienten. Kommagetrennt bei mehreren IDs" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
-	FromStdIn bool     `help:"PatientenIDs von StdIn lesen" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
-	OcaPlus   bool     `help:"Alle Patienten mit OCAPlus-Panel" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
-	Wes       bool     `help:"Alle Patienten mit WES" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
-	Wgs       bool     `help:"Alle Patienten mit WGS" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
-	All       bool     `help:"Alle Patienten" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
-	PersStamm int      `help:"ID des Personenstamms" group:"Patienten" default:"4"`
+	PatientID  []string  `help:"PatientenIDs der zu exportierenden Patienten. Kommagetrennt bei mehreren IDs" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
+	FromStdIn  bool      `help:"PatientenIDs von StdIn lesen" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
+	OcaPlus    bool      `help:"Alle Patienten mit OCAPlus-Panel" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
+	Wes        bool      `help:"Alle Patienten mit WES" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
+	Wgs        bool      `help:"Alle Patienten mit WGS" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
+	All        bool      `help:"Alle Patienten" group:"Patienten" xor:"PatientID,FromStdIn,OcaPlus,Wes,Wgs,All" required:"true"`
+	PersStamm  []int     `help:"ID des Personenstamms. Kommagetrennt bei mehreren Personenstämmen" group:"Patienten" default:"4"`
+	From       time.Time `help:"Nur Patienten und Proben ab diesem Datum (YYYY-MM-DD), siehe '--date-field'" group:"Patienten" format:"2006-01-02"`
+	To         time.Time `help:"Nur Patienten und Proben bis zu diesem Datum (YYYY-MM-DD), siehe '--date-field'" group:"Patienten" format:"2006-01-02"`
+	DateField  string    `help:"Datum für '--from' und '--to': Sequenzierung ('sequencing'), MTB ('mtb') oder Diagnose ('diagnosis') der Erkrankung" group:"Patienten" enum:"sequencing,mtb,diagnosis" default:"sequencing"`
+	Icd10      []string  `name:"icd10" help:"Nur Proben von Erkrankungen mit Diagnose mit diesem ICD-10-Code bzw. Anfang des Codes, z.B. 'C34'. Kommagetrennt bei mehreren Codes" group:"Patienten"`
+	Morphology []string  `help:"Nur Proben von Erkrankungen mit Diagnose mit diesem ICD-O-3-Morphologiecode bzw. Anfang des Codes, z.B. '8140/3'. Kommagetrennt bei mehreren Codes" group:"Patienten"`
+}
+
+// Prüft den Zeitraum der Auswahl
+func (selection *PatientSelection) Validate() error {
+	if !selection.From.IsZero() && !selection.To.IsZero() && selection.From.After(selection.To) {
+		return errors.New("'--from' muss vor '--to' liegen")
+	}
+	return nil
 }
 
 type CLI struct {
@@ -79,27 +123,37 @@ type CLI struct {
 	Preview struct {
 	} `cmd:"NA" help:"Show patient data. Exit Preview-Mode with <CTRL>+'C'"`
 
-	FakePatients struct {
-		Input       string `help:"Lese Einsendenummern aus dieser (MAF-)Datei" required:"NA"`
-		PatientFile string `help:"Exportiere Fake-Patienten in diese Datei" required:"NA"`
-		SamplesFile string `help:"Exportiere angepasste Samples mit Fake-PatientID in diese Datei" required:"NA"`
-	} `cmd:"NA" help:"Create fake patients based on samples"`
+	FakePatients FakePatientsCmd `cmd:"NA" help:"Create fake patients based on samples"`
+
+	AnonymizeFile AnonymizeFileCmd `cmd:"NA" help:"Anonymize sample IDs in VCF, SEG or MAF files"`
+
+	FakeOnkostar FakeOnkostarCmd `cmd:"NA" help:"Create synthetic Onkostar database with generated data"`
+
+	MtbTypes MtbTypesCmd `cmd:"NA" help:"Zeigt alle Typen von Tumorkonferenzen in Onkostar mit Anzahl"`
+
+	Config ConfigCmd `cmd:"NA" help:"Verwaltet Verbindungsprofile in der Konfigurationsdatei"`
+
+	Run RunCmd `cmd:"NA" help:"Führt einen Export-Job aus einer YAML-Datei aus"`
 }
 
 func initCLI() {
 	cli = &CLI{
 		Globals: Globals{},
 	}
-	homedir, _ := os.UserHomeDir()
-	context = kong.Parse(cli,
+	kongContext = kong.Parse(cli, append(kongOptions(), kong.UsageOnError())...)
+}
+
+// Optionen des Kommandozeilenparsers, auch für die Befehle eines Export-Jobs verwendet
+func kongOptions() []kong.Option {
+	return []kong.Option{
 		kong.Name("os2cb"),
 		kong.Description("A simple tool to export data from Onkostar into TSV file format for cBioportal"),
-		kong.UsageOnError(),
 		kong.ConfigureHelp(kong.HelpOptions{
 			Compact: true,
 		}),
-		kong.Configuration(kong.JSON, fmt.Sprintf("%s/.osdb-config.json", homedir)),
-	)
+		kong.Configuration(kong.JSON, configFilename()),
+		kong.Resolvers(profileResolver(configFilename())),
+	}
 }
 
 func main() {
@@ -109,27 +163,37 @@ func main() {
 	gocsv.SetCSVWriter(getCsvWriter(cli.ExportPatients.Csv || cli.ExportSamples.Csv))
 	gocsv.SetCSVReader(getCsvReader(cli.ExportPatients.Csv || cli.ExportSamples.Csv))
 
-	if cli.Globals.SaveDbConfig {
-		out := fmt.Sprintf(`{
-  "user": "%s",
-  "host": "%s",
-  "port": "%d",
-  "database": "%s"
-}`,
-			cli.Globals.User,
-			cli.Globals.Host,
-			cli.Globals.Port,
-			cli.Globals.Database,
-		)
-		homedir, err1 := os.UserHomeDir()
-		filename := fmt.Sprintf("%s/.osdb-config.json", homedir)
-		err2 := os.WriteFile(filename, []byte(out), 0644)
-
-		if err1 != nil || err2 != nil {
-			log.Fatalln(fmt.Errorf("error writing config file"))
+	if strings.HasPrefix(kongContext.Command(), "config") {
+		if err := configCommand(os.Stdout, configFilename(), kongContext, &cli.Config); err != nil {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+
+	// Ein Export-Job wird vollständig geprüft, bevor die Datenbankverbindung mit den Parametern des ersten Befehls
+	// hergestellt wird
+	var job *Job
+	var jobSteps []JobStep
+	if kongContext.Command() == "run <job>" {
+		var err error
+		if job, jobSteps, err = loadJob(cli.Run.Job, jobStepParser(kongOptions())); err != nil {
+			log.Fatalln(err.Error())
+		}
+		if cli.Run.Check {
+			fmt.Printf("Job-Datei '%s' ist gültig\n", cli.Run.Job)
+			for _, step := range jobSteps {
+				fmt.Printf("  %s\n", strings.Join(step.Args, " "))
+			}
 			return
 		}
-		fmt.Printf("config file written to %s\n", filename)
+		cli, kongContext = jobSteps[0].cli, jobSteps[0].context
+	}
+
+	if cli.Globals.SaveDbConfig {
+		if err := saveDbConfig(configFilename(), cli); err != nil {
+			log.Fatalln(err.Error())
+		}
+		fmt.Printf("config file written to %s\n", configFilename())
 	}
 
 	// Check PatientIDs on stdin used in bash pipe
@@ -142,36 +206,77 @@ func main() {
 		cli.PatientID = splitRegEx.Split(strings.TrimSpace(string(input)), -1)
 	}
 
-	if context.Command() == "fake-patients" {
+	if kongContext.Command() == "fake-patients" {
 		fakePatients(cli)
 		return
 	}
 
-	if (context.Command() == "export-xls" || context.Command() == "export-xlsx") && !strings.HasSuffix(cli.ExportXlsx.Filename, ".xlsx") {
+	if kongContext.Command() == "anonymize-file" {
+		if err := AnonymizeFile(cli.AnonymizeFile.Input, cli.AnonymizeFile.Output, cli.AnonymizeFile.Format, newPseudonymizer(cli)); err != nil {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+
+	if kongContext.Command() == "fake-onkostar" && !cli.FakeOnkostar.Execute {
+		fakeOnkostar(cli, nil)
+		return
+	}
+
+	if (kongContext.Command() == "export-xls" || kongContext.Command() == "export-xlsx") && !strings.HasSuffix(cli.ExportXlsx.Filename, ".xlsx") {
 		log.Fatalf("Cannot use filename: '%s'. Required filename suffix is '.xlsx'", cli.ExportXlsx.Filename)
 		return
 	}
 
-	if len(cli.Password) == 0 {
-		fmt.Print("Passwort: ")
-		if bytePw, err := term.ReadPassword(int(syscall.Stdin)); err == nil {
-			cli.Password = string(bytePw)
+	if password, err := resolvePassword(cli); err == nil {
+		cli.Password = password
+	} else {
+		log.Fatalln(err.Error())
+	}
+
+	tlsConfig, err := registerTLSConfig(cli)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	network := "tcp"
+	address := fmt.Sprintf("%s:%d", cli.Host, cli.Port)
+	if len(cli.Socket) > 0 {
+		network = "unix"
+		address = cli.Socket
+	} else if len(cli.SshHost) > 0 {
+		sshClient, err := dialSSH(cli)
+		if err != nil {
+			log.Fatalln(err.Error())
 		}
-		println()
+		defer func() {
+			_ = sshClient.Close()
+		}()
+		registerSSHDialer(sshClient)
+		network = sshNetwork
 	}
 
 	dbCfg := mysql.Config{
-		User:                 cli.User,
-		Passwd:               cli.Password,
-		Net:                  "tcp",
-		Addr:                 fmt.Sprintf("%s:%d", cli.Host, cli.Port),
-		DBName:               cli.Database,
-		AllowNativePasswords: true,
-		TLSConfig:            cli.Ssl,
+		User:                     cli.User,
+		Passwd:                   cli.Password,
+		Net:                      network,
+		Addr:                     address,
+		DBName:                   cli.Database,
+		AllowNativePasswords:     true,
+		TLSConfig:                tlsConfig,
+		AllowFallbackToPlaintext: tlsConfig == customTLSConfigName && cli.Ssl == "preferred",
+		ReadTimeout:              cli.ReadTimeout,
 	}
 
 	if dbx, dbErr := initDb(dbCfg); dbErr == nil {
 		db = dbx
+		configurePool(db, cli)
+		if cli.SaveDbConfig && cli.Keyring {
+			if err := savePasswordToKeyring(cli); err != nil {
+				log.Fatalln(err.Error())
+			}
+			fmt.Println("Passwort im Schlüsselbund gespeichert")
+		}
 		defer func(db *sql.DB) {
 			err := db.Close()
 			if err != nil {
@@ -182,39 +287,83 @@ func main() {
 		log.Fatalf("Cannot connect to Database: %s\n", dbErr.Error())
 	}
 
-	if cli.OcaPlus {
-		patients := InitPatients(db)
-		cli.PatientID, _ = patients.FetchOcaPlusPatientIds()
+	// Abbruch mit <CTRL>+'C' bricht laufende Datenbankabfragen ab
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cli.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cli.Timeout)
+		defer cancel()
 	}
 
-	if cli.Wes {
-		patients := InitPatients(db)
-		cli.PatientID, _ = patients.FetchWESPatientIds()
+	if job != nil {
+		if err := runJob(ctx, job, jobSteps, db); err != nil {
+			log.Fatalln(err.Error())
+		}
+		return
 	}
 
-	if cli.Wgs {
-		patients := InitPatients(db)
-		cli.PatientID, _ = patients.FetchWGSPatientIds()
+	if err := executeCommand(ctx, cli, db); err != nil {
+		exitWithReport(err)
+	}
+}
+
+// Startet mit '--consistent-read' die lesende Transaktion für alle folgenden Abfragen, sofern nicht bereits eine
+// Transaktion besteht, z.B. für alle Befehle eines Jobs. Die zurückgegebene Funktion beendet die gestartete Transaktion.
+func beginReadTx(ctx context.Context, cli *CLI, db *sql.DB) (func(), error) {
+	if !cli.ConsistentRead || readTx != nil {
+		return func() {}, nil
 	}
 
-	if cli.All {
-		patients := InitPatients(db)
-		cli.PatientID, _ = patients.FetchAllPatientIds()
+	tx, err := export.BeginConsistentRead(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot start transaction: %w", err)
 	}
+	readTx = tx
+	return func() {
+		readTx = nil
+		_ = tx.Rollback()
+	}, nil
+}
+
+// Ermittelt die zu verwendenden Patienten und führt den angegebenen Befehl mit bestehender Datenbankverbindung aus.
+// Fehler, die zum Abbruch führen, sind noch nicht im Fehlerbericht enthalten.
+func executeCommand(ctx context.Context, cli *CLI, db *sql.DB) error {
+	exportReport = NewErrorReport(kongContext.Command())
 
-	switch context.Command() {
+	endReadTx, err := beginReadTx(ctx, cli, db)
+	if err != nil {
+		return err
+	}
+	defer endReadTx()
+
+	if cli.OcaPlus || cli.Wes || cli.Wgs || cli.All {
+		patientIds, err := newExporter(cli, db).FetchPatientIds(ctx)
+		if err != nil {
+			log.Printf("Patienten-IDs können nicht ermittelt werden: %s\n", err.Error())
+			exportReport.AddError(err)
+		}
+		cli.PatientID = patientIds
+	}
+
+	switch kongContext.Command() {
 	case "export-patients":
-		handleCommand(cli, db, FetchAllPatientData)
+		return handleCommand(ctx, cli, db, FetchAllPatientData)
 	case "export-samples":
-		handleCommand(cli, db, FetchAllSampleData)
+		return handleCommand(ctx, cli, db, FetchAllSampleData)
 	case "export-xlsx":
-		exportXlsx(cli, cli.PatientID, db)
+		return exportXlsx(ctx, cli, cli.PatientID, db)
 	case "export-xls":
-		exportXlsx(cli, cli.PatientID, db)
+		return exportXlsx(ctx, cli, cli.PatientID, db)
 	case "preview":
-		preview(db)
+		preview(ctx, db)
+	case "fake-onkostar":
+		fakeOnkostar(cli, db)
+	case "mtb-types":
+		return printMtbTypes(ctx, os.Stdout, cli, db)
 	default:
 	}
+	return nil
 }
 
 func initDb(dbCfg mysql.Config) (*sql.DB, error) {
@@ -229,16 +378,11 @@ func initDb(dbCfg mysql.Config) (*sql.DB, error) {
 	}
 }
 
-func AnonymizedID(id string) string {
-	if cli.NoAnon {
-		return id
-	}
-
-	sha := sha256.New()
-	sha.Write([]byte(id))
-	hash := hex.EncodeToString(sha.Sum(nil))
-
-	return cli.IDPrefix + "_" + hash[0:10]
+// Setzt die Einstellungen des Verbindungspools. Die Anzahl paralleler Abfragen ist durch die maximale Anzahl
+// Verbindungen begrenzt.
+func configurePool(db *sql.DB, cli *CLI) {
+	db.SetMaxOpenConns(cli.MaxOpenConns)
+	db.SetConnMaxLifetime(cli.ConnMaxLifetime)
 }
 
 // Übergibt Methode zum Erstellen des passenden CsvWriters für TSV (cBioportal) oder CSV (Excel mit UTF16BE)
@@ -281,7 +425,7 @@ func getCsvReader(isCsv bool) func(in io.Reader) gocsv.CSVReader {
 }
 
 // Bearbeitet die Ausführung und ermittelt Daten abhängig von übergebener Funktion
-func handleCommand[D PatientData | SampleData](cli *CLI, db *sql.DB, fetchFunc func(patientIds []string, db *sql.DB) ([]D, error)) {
+func handleCommand[D export.PatientData | export.SampleData](ctx context.Context, cli *CLI, db *sql.DB, fetchFunc func(ctx context.Context, patientIds []string, db *sql.DB) ([]D, error)) error {
 	var result []D
 	var filename string
 	if len(cli.ExportPatients.Filename) > 0 {
@@ -294,145 +438,336 @@ func handleCommand[D PatientData | SampleData](cli *CLI, db *sql.DB, fetchFunc f
 		if r, err := ReadFile(filename, result); err == nil {
 			result = r
 		} else {
-			log.Fatalln(err.Error())
+			return err
 		}
 	}
 
-	if r, err := fetchFunc(cli.PatientID, db); err == nil {
+	if r, err := fetchFunc(ctx, cli.PatientID, db); err == nil {
 		result = append(result, r...)
 	} else {
-		log.Fatalln(err.Error())
+		return err
+	}
+
+	if err := checkExport(ctx); err != nil {
+		return err
 	}
 
 	if err := WriteFile(filename, result); err != nil {
-		log.Fatalln(err.Error())
+		return err
 	}
+	writeErrorReport()
+	return nil
 }
 
-func exportXlsx(cli *CLI, patientIds []string, db *sql.DB) {
-	patientsData := make([]PatientData, 0)
-	samplesData := make([]SampleData, 0)
-	if data, err := FetchAllPatientData(patientIds, db); err == nil {
-		patientsData = append(patientsData, data...)
-	} else {
-		log.Printf("%s", err.Error())
-	}
-	if data, err := FetchAllSampleData(patientIds, db); err == nil {
-		samplesData = append(samplesData, data...)
-	} else {
-		log.Printf("%s", err.Error())
+func exportXlsx(ctx context.Context, cli *CLI, patientIds []string, db *sql.DB) error {
+	patientsData := make([]export.PatientData, 0)
+	samplesData := make([]export.SampleData, 0)
+	exporter := newExporter(cli, db)
+	patients, samples, err := exporter.FetchAll(ctx, patientIds)
+	logExportErrors(exporter, err)
+	if err := checkExport(ctx); err != nil {
+		return err
 	}
+	patientsData = append(patientsData, patients...)
+	samplesData = append(samplesData, samples...)
 
 	if err := WriteXlsxFile(cli.ExportXlsx.Filename, patientsData, samplesData); err != nil {
-		log.Fatalln(err.Error())
+		return err
 	}
+	writeErrorReport()
+	return nil
 }
 
-func preview(db *sql.DB) {
-	NewBrowser(cli.PatientID, cli.NoAnon, db).Show()
+// Anonymisierung der Proben-IDs in einer Datei
+type AnonymizeFileCmd struct {
+	Input  string `help:"Lese Daten aus dieser Datei (VCF, SEG oder MAF, auch gzip-komprimiert)" required:"NA"`
+	Output string `help:"Schreibe anonymisierte Daten in diese Datei. Bei Endung '.gz' gzip-komprimiert" required:"NA"`
+	Format string `help:"Dateiformat ('vcf', 'seg', 'maf'). Bei 'auto' anhand der Dateiendung" enum:"auto,vcf,seg,maf" default:"auto"`
 }
 
-func fakePatients(cli *CLI) {
-	var sampleData []SampleData
-	if r, err := ReadFile(cli.FakePatients.Input, sampleData); err == nil {
-		sampleData = r
-	} else {
-		log.Fatalln(err.Error())
+// Die Anonymisierung einer Datei erfolgt ohne Datenbankverbindung und ohne Auswahl von Patienten
+func (cmd *AnonymizeFileCmd) BeforeApply(kctx *kong.Context) error {
+	relaxGlobalFlags(kctx)
+	return nil
+}
+
+// Erzeugung von Fake-Patienten zu den Proben einer Datei
+type FakePatientsCmd struct {
+	Input         string `help:"Lese Einsendenummern aus dieser Datei (Probendaten, MAF oder VCF, auch gzip-komprimiert)" required:"NA"`
+	InputFormat   string `help:"Format der Eingabedatei ('samples', 'maf', 'vcf'). Bei 'auto' anhand der Dateiendung" enum:"auto,samples,maf,vcf" default:"auto"`
+	GroupFile     string `help:"Datei mit Zuordnung von Einsendenummer zu Patient (je Zeile: Einsendenummer und Patient)" xor:"GroupFile,GroupPattern"`
+	GroupPattern  string `help:"Regulärer Ausdruck zur Ermittlung des Patienten aus der Einsendenummer (Gruppe 'patient' oder erste Gruppe)" xor:"GroupFile,GroupPattern"`
+	MutationsFile string `help:"Exportiere Mutationsdaten mit angepassten Einsendenummern in diese Datei (nur MAF oder VCF)"`
+	Anonymize     bool   `help:"Anonymisiere Einsendenummern in Proben- und Mutationsdaten" default:"false"`
+	PatientFile   string `help:"Exportiere Fake-Patienten in diese Datei" required:"NA"`
+	SamplesFile   string `help:"Exportiere angepasste Samples mit Fake-PatientID in diese Datei" required:"NA"`
+	Synthetic     bool   `help:"Erzeuge realistische synthetische Patienten- und Probendaten anstelle von 'NA'" default:"false"`
+	Seed          uint64 `help:"Seed für reproduzierbare synthetische Daten" default:"1"`
+	Distribution  string `help:"JSON-Datei mit Verteilungen für synthetische Daten. Ohne Angabe wird eine Standardverteilung verwendet"`
+}
+
+// Die Fake-Patienten werden ohne Datenbankverbindung und ohne Auswahl von Patienten erzeugt
+func (cmd *FakePatientsCmd) BeforeApply(kctx *kong.Context) error {
+	relaxGlobalFlags(kctx)
+	return nil
+}
+
+// Hebt die Pflichtangaben aller Optionen außerhalb des ausgewählten Kommandos auf
+func relaxGlobalFlags(kctx *kong.Context) {
+	own := kctx.Selected().Flags
+	for _, flag := range kctx.Flags() {
+		if !slices.Contains(own, flag) {
+			flag.Required = false
+		}
 	}
+}
 
-	var uniqueSampleIds = make([]string, 0)
-	var fakePatients = make([]PatientData, 0)
-	var fixedSamples = make([]SampleData, 0)
+// Erzeugung einer synthetischen Onkostar-Datenbank
+type FakeOnkostarCmd struct {
+	Output        string `help:"Schreibe SQL-Skript in diese Datei" xor:"Output,Execute" required:"true"`
+	Execute       bool   `help:"Erzeuge Tabellen und Daten direkt in der mit '--database' angegebenen, leeren Datenbank" xor:"Output,Execute" required:"true"`
+	Patients      int    `help:"Anzahl der zu erzeugenden Patienten" default:"50"`
+	Seed          uint64 `help:"Seed für reproduzierbare synthetische Daten" default:"1"`
+	Distribution  string `help:"JSON-Datei mit Verteilungen für synthetische Daten. Ohne Angabe wird eine Standardverteilung verwendet"`
+	ReferenceDate string `help:"Stichtag (YYYY-MM-DD), relativ zu dem Datumswerte erzeugt werden. Ohne Angabe: heute"`
+	NoSchema      bool   `help:"Keine Tabellen anlegen, nur Daten einfügen" default:"false"`
+}
 
-	// Ersetze PatientID
-	for _, sample := range sampleData {
-		if !slices.Contains(uniqueSampleIds, sample.SampleID) {
-			uniqueSampleIds = append(uniqueSampleIds, sample.SampleID)
+// Für ein SQL-Skript ist keine Datenbankverbindung und für beide Varianten keine Auswahl von Patienten erforderlich.
+// Direkt in eine Datenbank wird nur geschrieben, wenn diese auf der Kommandozeile angegeben ist und nicht aus der
+// Konfigurationsdatei oder einem Profil stammt.
+func (cmd *FakeOnkostarCmd) BeforeApply(kctx *kong.Context) error {
+	execute, database := false, false
+	for _, path := range kctx.Path {
+		if path.Flag == nil {
+			continue
+		}
+		switch path.Flag.Name {
+		case "execute":
+			execute = true
+		case "database":
+			database = database || !path.Resolved
 		}
+	}
+	if execute && !database {
+		return errors.New("'--execute' erfordert die Angabe der Datenbank mit '--database'")
+	}
 
-		// Neue Fake-PatientID
-		fakePatientId := fmt.Sprintf("2000%d", slices.IndexFunc(uniqueSampleIds, func(s string) bool {
-			return sample.SampleID == s
-		}))
-		sample.PatientID = fakePatientId
-
-		fixedSamples = append(fixedSamples, sample)
-	}
-
-	// Für jede unique Sample-ID
-	for idx := range uniqueSampleIds {
-		fakePatients = append(fakePatients, PatientData{
-			ID:                       fmt.Sprintf("2000%d", idx),
-			Gender:                   "NA",
-			Sex:                      "NA",
-			Age:                      "NA",
-			IcdO3MorphCode:           "NA",
-			Diagnosis:                "NA",
-			OncotreeCode:             "NA",
-			Icd10Code:                "NA",
-			SpreadOfDisease:          "NA",
-			MtbEcogStatus:            "NA",
-			PastMalignantDisease:     "NA",
-			PretherapyProgress:       "NA",
-			NumSystemicPretherapy:    "NA",
-			PretherapyMedication:     "NA",
-			PretherapyMedicationNcit: "NA",
-			PretherapyBestResponse:   "NA",
-			PretherapyPfs:            "NA",
-			OsStatus:                 "NA",
-			OsMonths:                 "NA",
-			DfsStatus:                "NA",
-			DfsMonths:                "NA",
-			XFirstMtbYear:            "NA",
-		})
-	}
-
-	if err := WriteFile(cli.FakePatients.PatientFile, fakePatients); err != nil {
-		log.Fatalln(err.Error())
+	for _, flag := range kctx.Flags() {
+		if !execute || (flag.Group != nil && flag.Group.Key == "Patienten") {
+			flag.Required = false
+		}
 	}
+	return nil
+}
 
-	if err := WriteFile(cli.FakePatients.SamplesFile, fixedSamples); err != nil {
-		log.Fatalln(err.Error())
+// Anzeige der Typen von Tumorkonferenzen, z.B. zur Auswahl mit '--mtb-type'
+type MtbTypesCmd struct {
+}
+
+// Für die Anzeige der Typen von Tumorkonferenzen ist keine Auswahl von Patienten erforderlich
+func (cmd *MtbTypesCmd) BeforeApply(kctx *kong.Context) error {
+	for _, flag := range kctx.Flags() {
+		if flag.Group != nil && flag.Group.Key == "Patienten" {
+			flag.Required = false
+		}
 	}
+	return nil
 }
 
-// Ermittelt alle Patientendaten von allen angegebenen Patienten
-func FetchAllPatientData(patientIds []string, db *sql.DB) ([]PatientData, error) {
-	patients := InitPatients(db)
-	if data, err := patients.FetchBy(patientIds, cli.MtbType, cli.AllTk); err == nil {
-		return data, nil
-	} else {
-		if !strings.HasPrefix(context.Command(), "preview") {
-			log.Println(err.Error())
+// Gibt alle Typen von Tumorkonferenzen mit Anzahl aus
+func printMtbTypes(ctx context.Context, out io.Writer, cli *CLI, db *sql.DB) error {
+	source := export.NewSQLSource(db, cli.QueryTimeout).WithPersStamm(cli.PersStamm)
+	if readTx != nil {
+		source = export.NewSQLSourceTx(readTx, cli.QueryTimeout).WithPersStamm(cli.PersStamm)
+	}
+	mtbTypes, err := source.MtbTypes(ctx)
+	if err != nil {
+		return fmt.Errorf("Typen von Tumorkonferenzen können nicht ermittelt werden: %w", err)
+	}
+	_, _ = fmt.Fprintln(out, "MTB-Typ\tAnzahl")
+	for _, mtbType := range mtbTypes {
+		_, _ = fmt.Fprintf(out, "%s\t%d\n", mtbType.MtbType, mtbType.Count)
+	}
+	return nil
+}
+
+func preview(ctx context.Context, db *sql.DB) {
+	NewBrowser(ctx, cli.PatientID, cli.NoAnon, db).Show()
+}
+
+// Erzeugt eine synthetische Onkostar-Datenbank als SQL-Skript oder direkt in der angegebenen Datenbank
+func fakeOnkostar(cli *CLI, db *sql.DB) {
+	distribution, err := ReadSyntheticDistribution(cli.FakeOnkostar.Distribution)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	referenceDate := time.Now().Truncate(24 * time.Hour)
+	if len(cli.FakeOnkostar.ReferenceDate) > 0 {
+		if referenceDate, err = time.Parse("2006-01-02", cli.FakeOnkostar.ReferenceDate); err != nil {
+			log.Fatalf("Cannot use reference date: '%s'", cli.FakeOnkostar.ReferenceDate)
 		}
 	}
-	return []PatientData{}, nil
+
+	fixture := NewOnkostarFixture(distribution, cli.FakeOnkostar.Seed, referenceDate)
+	statements := fixture.Generate(cli.FakeOnkostar.Patients, !cli.FakeOnkostar.NoSchema)
+
+	if db != nil {
+		if err := CheckEmptyOnkostar(db); err != nil {
+			log.Fatalln(err.Error())
+		}
+		if err := ExecuteSqlStatements(db, statements); err != nil {
+			log.Fatalln(err.Error())
+		}
+		fmt.Printf("%d Patienten in Datenbank '%s' erzeugt\n", cli.FakeOnkostar.Patients, cli.Database)
+		return
+	}
+
+	file, err := os.Create(cli.FakeOnkostar.Output)
+	if err != nil {
+		log.Fatalln("file: Datei kann nicht geöffnet werden")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if err := WriteSqlScript(file, statements); err != nil {
+		log.Fatalln(err.Error())
+	}
 }
 
-// Ermittelt alle Probendaten von allen angegebenen Patienten
-func FetchAllSampleData(patientIds []string, db *sql.DB) ([]SampleData, error) {
-	filter := None
+// Erstellt den Exporter anhand der Kommandozeilenparameter
+func newExporter(cli *CLI, db *sql.DB) *export.Exporter {
+	filter := export.None
 
 	if cli.OcaPlus {
-		filter = OcaPlusOnly
+		filter = export.OcaPlusOnly
 	} else if cli.Wes {
-		filter = WesOnly
+		filter = export.WesOnly
 	} else if cli.Wgs {
-		filter = WgsOnly
+		filter = export.WgsOnly
 	}
 
-	samples := InitSamples(db, filter)
-	var result []SampleData
-	for _, patientID := range patientIds {
-		if data, err := samples.Fetch(patientID); err == nil {
-			for _, d := range data {
-				result = append(result, d)
-			}
-		} else {
-			if !strings.HasPrefix(context.Command(), "preview") {
-				log.Println(err.Error())
-			}
-		}
+	dateField := export.SequencingDate
+	switch cli.DateField {
+	case "mtb":
+		dateField = export.MtbDate
+	case "diagnosis":
+		dateField = export.DiagnosisDate
+	}
+
+	config := export.Config{
+		MtbTypes:     cli.MtbType,
+		AllTk:        cli.AllTk,
+		Filter:       filter,
+		PersStamm:    cli.PersStamm,
+		DateRange:    export.DateRange{Field: dateField, From: cli.From, To: cli.To},
+		Icd10:        cli.Icd10,
+		Morphology:   cli.Morphology,
+		ChunkSize:    cli.ChunkSize,
+		Workers:      cli.Workers,
+		QueryTimeout: cli.QueryTimeout,
+		Retries:      cli.Retries,
+		RetryDelay:   cli.RetryDelay,
+	}
+
+	if readTx != nil {
+		return export.NewTxExporter(config, readTx, newPseudonymizer(cli))
+	}
+	return export.NewExporter(config, db, newPseudonymizer(cli))
+}
+
+// Ermittelt die Pseudonymisierung anhand der Kommandozeilenparameter
+func newPseudonymizer(cli *CLI) export.Pseudonymizer {
+	if cli.NoAnon {
+		return export.NoPseudonymizer{}
 	}
+	return export.HashPseudonymizer{Prefix: cli.IDPrefix}
+}
+
+// Ermittelt alle Patientendaten von allen angegebenen Patienten
+func FetchAllPatientData(ctx context.Context, patientIds []string, db *sql.DB) ([]export.PatientData, error) {
+	exporter := newExporter(cli, db)
+	result, err := exporter.FetchPatientData(ctx, patientIds)
+	logExportErrors(exporter, err)
 	return result, nil
 }
+
+// Ermittelt alle Probendaten von allen angegebenen Patienten
+func FetchAllSampleData(ctx context.Context, patientIds []string, db *sql.DB) ([]export.SampleData, error) {
+	exporter := newExporter(cli, db)
+	result, err := exporter.FetchSampleData(ctx, patientIds)
+	logExportErrors(exporter, err)
+	return result, nil
+}
+
+// Fehler bei unvollständigem Export mit '--strict'. Die Fehler der Patienten sind bereits im Fehlerbericht enthalten.
+var errIncompleteExport = errors.New("Export unvollständig: Keine Datei geschrieben")
+
+// Prüft vor dem Schreiben einer Datei, ob der Export abgebrochen wurde, zu lange gedauert hat oder mit '--strict'
+// Fehler aufgetreten sind
+func checkExport(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errors.New("Export abgebrochen: Zeitüberschreitung")
+	} else if ctx.Err() != nil {
+		return errors.New("Export abgebrochen")
+	}
+	if cli.Strict && !exportReport.Complete {
+		return errIncompleteExport
+	}
+	return nil
+}
+
+// Fügt einen Fehler, der zum Abbruch eines Befehls geführt hat, dem Fehlerbericht hinzu
+func addCommandError(report *ErrorReport, err error) {
+	if !errors.Is(err, errIncompleteExport) {
+		report.AddError(err)
+	}
+}
+
+// Beendet die Anwendung mit Fehler und schreibt zuvor ggf. den Fehlerbericht
+func exitWithReport(err error) {
+	addCommandError(exportReport, err)
+	writeErrorReport()
+	log.Fatalln(err.Error())
+}
+
+// Schreibt den Fehlerbericht, wenn mit '--error-report' angegeben
+func writeErrorReport() {
+	if len(cli.ErrorReport) == 0 {
+		return
+	}
+	if err := exportReport.Write(cli.ErrorReport); err != nil {
+		log.Fatalln(err.Error())
+	}
+}
+
+// Gibt wiederholte Abfragen und Fehler eines Exports zusammengefasst aus. Im Preview-Modus erfolgt keine Ausgabe.
+func logExportErrors(exporter *export.Exporter, err error) {
+	if strings.HasPrefix(kongContext.Command(), "preview") {
+		return
+	}
+
+	retried := exporter.RetriedPatients()
+	exportReport.AddRetried(retried)
+	if len(retried) > 0 {
+		log.Printf("Abfragen für %d Patienten nach vorübergehendem Datenbankfehler wiederholt: %s\n", len(retried), strings.Join(retried, ", "))
+	}
+
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	exportReport.AddError(err)
+
+	patientErrors := export.PatientErrors(err)
+	if len(patientErrors) == 0 {
+		log.Println(err.Error())
+		return
+	}
+
+	log.Printf("Fehler beim Export von %d Patienten:\n", len(patientErrors))
+	for _, patientErr := range patientErrors {
+		log.Printf("  %s\n", patientErr.Error())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"os2cb/export"
+)
+
+// Fehlerbericht eines Exports, wird mit '--error-report' als JSON-Datei geschrieben
+type ErrorReport struct {
+	Command         string          `json:"command"`
+	Complete        bool            `json:"complete"`
+	FailedPatients  []FailedPatient `json:"failed_patients"`
+	RetriedPatients []string        `json:"retried_patients"`
+	Errors          []string        `json:"errors"`
+}
+
+// Patient, dessen Daten nicht oder nicht vollständig exportiert werden konnten
+type FailedPatient struct {
+	PatientID string `json:"patient_id"`
+	Error     string `json:"error"`
+}
+
+// Erstellt einen leeren Fehlerbericht für den angegebenen Befehl
+func NewErrorReport(command string) *ErrorReport {
+	return &ErrorReport{
+		Command:         command,
+		Complete:        true,
+		FailedPatients:  []FailedPatient{},
+		RetriedPatients: []string{},
+		Errors:          []string{},
+	}
+}
+
+// Fügt den Fehler dem Bericht hinzu. Fehler zu einzelnen Patienten werden je Patient aufgeführt.
+func (report *ErrorReport) AddError(err error) {
+	if err == nil {
+		return
+	}
+	report.Complete = false
+
+	patientErrors := export.PatientErrors(err)
+	if len(patientErrors) == 0 {
+		report.Errors = append(report.Errors, err.Error())
+		return
+	}
+	for _, patientErr := range patientErrors {
+		report.FailedPatients = append(report.FailedPatients, FailedPatient{PatientID: patientErr.PatientID, Error: patientErr.Err.Error()})
+	}
+}
+
+// Fügt Patienten mit wiederholten Abfragen dem Bericht hinzu
+func (report *ErrorReport) AddRetried(patientIds []string) {
+	for _, patientID := range patientIds {
+		if !slices.Contains(report.RetriedPatients, patientID) {
+			report.RetriedPatients = append(report.RetriedPatients, patientID)
+		}
+	}
+	slices.Sort(report.RetriedPatients)
+}
+
+// Übernimmt Fehler und wiederholte Patienten aus einem weiteren Bericht
+func (report *ErrorReport) Merge(other *ErrorReport) {
+	if other == nil {
+		return
+	}
+	report.Complete = report.Complete && other.Complete
+	report.FailedPatients = append(report.FailedPatients, other.FailedPatients...)
+	report.Errors = append(report.Errors, other.Errors...)
+	report.AddRetried(other.RetriedPatients)
+}
+
+// Schreibt den Bericht als JSON-Datei
+func (report *ErrorReport) Write(filename string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.New("error-report: Fehler beim Erstellen des Fehlerberichts")
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error-report: Datei kann nicht geschrieben werden: %w", err)
+	}
+	return nil
+}
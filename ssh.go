@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Name des beim MySQL-Treiber registrierten Netzwerks für Verbindungen über den SSH-Tunnel
+const sshNetwork = "ssh"
+
+// Baut eine SSH-Verbindung zum Jump-Host auf. Der Host-Schlüssel wird anhand der known_hosts-Datei geprüft,
+// eine Verbindung zu unbekannten Hosts ist nicht möglich.
+func dialSSH(cli *CLI) (*ssh.Client, error) {
+	if len(cli.SshUser) == 0 || len(cli.SshKey) == 0 {
+		return nil, errors.New("ssh: Benutzer und Schlüsseldatei müssen angegeben werden")
+	}
+
+	key, err := os.ReadFile(cli.SshKey)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: Schlüsseldatei kann nicht gelesen werden: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		var passphraseErr *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseErr) {
+			return nil, errors.New("ssh: Verschlüsselte Schlüsseldateien werden nicht unterstützt")
+		}
+		return nil, fmt.Errorf("ssh: Schlüsseldatei kann nicht verwendet werden: %w", err)
+	}
+
+	knownHostsFile := cli.SshKnownHosts
+	if len(knownHostsFile) == 0 {
+		homedir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("ssh: known_hosts kann nicht ermittelt werden: %w", err)
+		}
+		knownHostsFile = filepath.Join(homedir, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: known_hosts kann nicht gelesen werden: %w", err)
+	}
+
+	address := cli.SshHost
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            cli.SshUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssh: Verbindung zu '%s' nicht möglich: %w", address, err)
+	}
+	return client, nil
+}
+
+// Registriert den SSH-Tunnel beim MySQL-Treiber. Verbindungen mit Netzwerk 'ssh' werden vom Jump-Host aus
+// zur angegebenen Datenbankadresse aufgebaut.
+func registerSSHDialer(client *ssh.Client) {
+	mysql.RegisterDialContext(sshNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+		return client.DialContext(ctx, "tcp", addr)
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Nutzdaten einer 'direct-tcpip'-Anfrage (RFC 4254, 7.2)
+type directTcpip struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+type sshTestSetup struct {
+	address        string
+	keyFile        string
+	knownHostsFile string
+}
+
+// Startet einen SSH-Server, der ausschließlich Port-Weiterleitungen für den angegebenen Client-Schlüssel erlaubt
+func startSSHServer(t *testing.T) sshTestSetup {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublicKey, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizedKey, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "os2cb" && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+
+	pemBlock, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(pemBlock), 0600); err != nil {
+		t.Fatal(err)
+	}
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(listener.Addr().String())}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return sshTestSetup{address: listener.Addr().String(), keyFile: keyFile, knownHostsFile: knownHostsFile}
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only port forwarding")
+			continue
+		}
+		target := directTcpip{}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		targetConn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			_ = targetConn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelRequests)
+		go func() {
+			_, _ = io.Copy(targetConn, channel)
+			_ = targetConn.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(channel, targetConn)
+			_ = channel.Close()
+		}()
+	}
+}
+
+func TestShouldConnectThroughSSHTunnel(t *testing.T) {
+	startOnkostarServer(t)
+	setup := startSSHServer(t)
+
+	sshClient, err := dialSSH(&CLI{Globals: Globals{SshHost: setup.address, SshUser: "os2cb", SshKey: setup.keyFile, SshKnownHosts: setup.knownHostsFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = sshClient.Close()
+	}()
+	registerSSHDialer(sshClient)
+
+	tunnelDb, err := initDb(mysql.Config{User: "root", Net: sshNetwork, Addr: integrationAddress, DBName: "onkostar", AllowNativePasswords: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = tunnelDb.Close()
+	}()
+
+	var count int
+	if err := tunnelDb.QueryRow("SELECT COUNT(*) FROM patient").Scan(&count); err != nil || count == 0 {
+		t.Logf("cannot query through tunnel: %d, %v", count, err)
+		t.Fail()
+	}
+}
+
+func TestShouldRejectUnknownSSHHost(t *testing.T) {
+	setup := startSSHServer(t)
+	otherHost := startSSHServer(t)
+
+	_, err := dialSSH(&CLI{Globals: Globals{SshHost: setup.address, SshUser: "os2cb", SshKey: setup.keyFile, SshKnownHosts: otherHost.knownHostsFile}})
+	if err == nil {
+		t.Log("expected unknown host key")
+		t.Fail()
+	}
+}
+
+func TestShouldRejectUnauthorizedSSHKey(t *testing.T) {
+	setup := startSSHServer(t)
+	otherClient := startSSHServer(t)
+
+	_, err := dialSSH(&CLI{Globals: Globals{SshHost: setup.address, SshUser: "os2cb", SshKey: otherClient.keyFile, SshKnownHosts: setup.knownHostsFile}})
+	if err == nil {
+		t.Log("expected authentication failure")
+		t.Fail()
+	}
+}
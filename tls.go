@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Name der beim MySQL-Treiber registrierten TLS-Konfiguration mit eigener CA und/oder Client-Zertifikat
+const customTLSConfigName = "os2cb"
+
+// Registriert eine TLS-Konfiguration, wenn CA, Client-Zertifikat oder Servername angegeben sind, und gibt
+// den in der Datenbankkonfiguration zu verwendenden Namen zurück. Andernfalls wird '--ssl' unverändert verwendet.
+// Mit eigener TLS-Konfiguration ist eine verschlüsselte Verbindung immer erforderlich, außer bei '--ssl=preferred'.
+func registerTLSConfig(cli *CLI) (string, error) {
+	if len(cli.SslCa) == 0 && len(cli.SslCert) == 0 && len(cli.SslKey) == 0 && len(cli.SslServerName) == 0 {
+		return cli.Ssl, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cli.SslServerName,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cli.Ssl == "skip-verify",
+	}
+
+	if len(cli.SslCa) > 0 {
+		pem, err := os.ReadFile(cli.SslCa)
+		if err != nil {
+			return "", fmt.Errorf("ssl-ca: Datei kann nicht gelesen werden: %w", err)
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return "", errors.New("ssl-ca: Keine Zertifikate im PEM-Format gefunden")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if len(cli.SslCert) > 0 || len(cli.SslKey) > 0 {
+		if len(cli.SslCert) == 0 || len(cli.SslKey) == 0 {
+			return "", errors.New("ssl-cert: Client-Zertifikat und Schlüssel müssen gemeinsam angegeben werden")
+		}
+		certificate, err := tls.LoadX509KeyPair(cli.SslCert, cli.SslKey)
+		if err != nil {
+			return "", fmt.Errorf("ssl-cert: Client-Zertifikat kann nicht geladen werden: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if err := mysql.RegisterTLSConfig(customTLSConfigName, tlsConfig); err != nil {
+		return "", err
+	}
+	return customTLSConfigName, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Erzeugt ein Zertifikat mit Schlüssel, signiert durch parent oder selbst signiert
+func createCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, key
+}
+
+// Schreibt Zertifikat und Schlüssel als PEM-Dateien und gibt die Dateinamen zurück
+func writeCertificate(t *testing.T, name string, certificate *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(t.TempDir(), name+".pem")
+	keyFile := filepath.Join(t.TempDir(), name+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+type tlsTestSetup struct {
+	address  string
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+// Startet einen MySQL-Server, der ausschließlich TLS-Verbindungen mit einem Zertifikat einer eigenen CA annimmt
+func startTLSServer(t *testing.T) tlsTestSetup {
+	t.Helper()
+
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := createCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "os2cb Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	serverCert, serverKey := createCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "onkostar.example"},
+		DNSNames:     []string{"onkostar.example"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientCert, clientKey := createCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "os2cb"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	caFile, _ := writeCertificate(t, "ca", ca, caKey)
+	certFile, keyFile := writeCertificate(t, "client", clientCert, clientKey)
+
+	provider := memory.NewDBProvider(memory.NewDatabase("onkostar"))
+	engine := sqle.NewDefault(provider)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	tlsServer, err := server.NewServer(server.Config{
+		Protocol: "tcp",
+		Address:  address,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		},
+		RequireSecureTransport: true,
+	}, engine, gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = tlsServer.Start()
+	}()
+	t.Cleanup(func() {
+		_ = tlsServer.Close()
+	})
+
+	return tlsTestSetup{address: address, caFile: caFile, certFile: certFile, keyFile: keyFile}
+}
+
+// Verbindet sich mit der angegebenen TLS-Konfiguration
+func connectTLS(t *testing.T, address string, tlsCli *CLI) error {
+	t.Helper()
+
+	tlsConfig, err := registerTLSConfig(tlsCli)
+	if err != nil {
+		return err
+	}
+	tlsDb, err := initDb(mysql.Config{
+		User:                 "root",
+		Net:                  "tcp",
+		Addr:                 address,
+		DBName:               "onkostar",
+		AllowNativePasswords: true,
+		TLSConfig:            tlsConfig,
+	})
+	if err != nil {
+		return err
+	}
+	return tlsDb.Close()
+}
+
+func TestShouldConnectWithCustomCa(t *testing.T) {
+	setup := startTLSServer(t)
+
+	err := connectTLS(t, setup.address, &CLI{Globals: Globals{Ssl: "false", SslCa: setup.caFile, SslCert: setup.certFile, SslKey: setup.keyFile}})
+	if err != nil {
+		t.Logf("cannot connect with custom CA: %v", err)
+		t.Fail()
+	}
+}
+
+func TestShouldNotConnectWithoutCustomCa(t *testing.T) {
+	setup := startTLSServer(t)
+
+	if err := connectTLS(t, setup.address, &CLI{Globals: Globals{Ssl: "true"}}); err == nil {
+		t.Log("expected unknown certificate authority")
+		t.Fail()
+	}
+}
+
+func TestShouldVerifyServerName(t *testing.T) {
+	setup := startTLSServer(t)
+
+	if err := connectTLS(t, setup.address, &CLI{Globals: Globals{SslCa: setup.caFile, SslServerName: "onkostar.example"}}); err != nil {
+		t.Logf("cannot connect with server name: %v", err)
+		t.Fail()
+	}
+	if err := connectTLS(t, setup.address, &CLI{Globals: Globals{SslCa: setup.caFile, SslServerName: "other.example"}}); err == nil {
+		t.Log("expected server name mismatch")
+		t.Fail()
+	}
+}
+
+func TestShouldRejectIncompleteTLSConfig(t *testing.T) {
+	setup := startTLSServer(t)
+
+	for name, tlsCli := range map[string]*CLI{
+		"cert without key": {Globals: Globals{SslCert: setup.certFile}},
+		"invalid ca":       {Globals: Globals{SslCa: setup.keyFile}},
+		"missing ca":       {Globals: Globals{SslCa: filepath.Join(t.TempDir(), "missing.pem")}},
+	} {
+		if _, err := registerTLSConfig(tlsCli); err == nil {
+			t.Logf("expected error for %s", name)
+			t.Fail()
+		}
+	}
+}
+
+func TestShouldKeepNamedSslConfig(t *testing.T) {
+	if actual, _ := registerTLSConfig(&CLI{Globals: Globals{Ssl: "skip-verify"}}); actual != "skip-verify" {
+		t.Logf("wrong TLS config: Expected 'skip-verify', got '%s'", actual)
+		t.Fail()
+	}
+}